@@ -0,0 +1,757 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"synchfolder/internal/logger"
+	"synchfolder/internal/synch"
+	"synchfolder/internal/utils"
+	"syscall"
+	"time"
+)
+
+// exit codes of the app
+const (
+	exitOK     = 0 // everything is done
+	exitFailed = 1 // some operations failed or a job is stopped after a critical error
+	exitUsage  = 2 // wrong command, flag or argument
+	exitConfig = 3 // the config can't be read or has problems
+	exitDiffer = 4 // verify found differences between source and synch folders
+
+	exitInterrupted = 130 // stopped by a second signal without waiting for operations in progress
+)
+
+const usage = `Usage: synchfolder <command> [flags] [arguments]
+
+Commands:
+  run                         synchronize folders until a critical error or a stop signal, the default command
+  sync [--once]               synchronize folders, with --once check them once, print a summary and exit
+  diff                        print changes that would be made without changing anything
+  verify                      compare content of every file with its copy and print differences
+  status                      print folders, state and trash of jobs
+  restore <path> [folder]     restore a file or folder from the trash to the source folder
+  help                        print this text
+
+Flags, before or after the command:
+  --config <path>   config file, by default configs/config.* in the working folder or next to the app
+  --log <path>      log file, by default logs/log.txt next to the configs folder
+  --source <path>   source folder, overrides sourcepath of the config
+  --dest <path>     synch folder, overrides synchpath of the config
+  --job <name>      only this job, required for --source and --dest with several jobs
+  --force           let the first check go on even if the breaker aborts it (run and sync)
+  --report <path>   file for the diff report, overrides report of the config (diff)
+
+Exit codes:
+  0  success
+  1  some operations failed or a job is stopped after a critical error
+  2  wrong command, flag or argument
+  3  the config can't be read or has problems
+  4  verify found differences
+  130  stopped by a second SIGINT or SIGTERM without waiting for copies in progress
+
+On SIGINT or SIGTERM the app starts no new operations, lets copies in progress finish for
+shutdowntimeout of the config and exits. A second signal exits at once. On SIGHUP the log
+file is opened again, so it may be moved by logrotate.
+`
+
+// options are flags of the command line
+type options struct {
+	config string
+	log    string
+	source string
+	dest   string
+	job    string
+	force  bool
+	once   bool
+	report string
+}
+
+// app is the state of a command: the config, its jobs and where output goes
+type app struct {
+	opts    options
+	cfg     *utils.Config
+	configs []*utils.JobConfig // configs of jobs in the same order
+	jobs    []*synch.Job
+	logs    string          // folder of the log and state files
+	ctx     context.Context // done when the app is stopped by a signal
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+// commands of the app by name
+var commands = map[string]func(a *app, args []string) int{
+	"run":     runCommand,
+	"sync":    syncCommand,
+	"diff":    diffCommand,
+	"verify":  verifyCommand,
+	"status":  statusCommand,
+	"restore": restoreCommand,
+}
+
+// func runs the command line args and returns the exit code. Flags may be given before the command, after it or both
+func cli(args []string, stdout, stderr io.Writer) int {
+
+	a := &app{stdout: stdout, stderr: stderr}
+
+	fs := flag.NewFlagSet("synchfolder", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	fs.StringVar(&a.opts.config, "config", "", "")
+	fs.StringVar(&a.opts.log, "log", "", "")
+	fs.StringVar(&a.opts.source, "source", "", "")
+	fs.StringVar(&a.opts.dest, "dest", "", "")
+	fs.StringVar(&a.opts.job, "job", "", "")
+	fs.BoolVar(&a.opts.force, "force", false, "")
+	fs.BoolVar(&a.opts.once, "once", false, "")
+	fs.StringVar(&a.opts.report, "report", "", "")
+
+	err := fs.Parse(args)
+
+	name := "run"
+
+	// flags after the command are parsed by the same set
+	if err == nil && fs.NArg() > 0 {
+		name = fs.Arg(0)
+		err = fs.Parse(fs.Args()[1:])
+	}
+
+	if errors.Is(err, flag.ErrHelp) || name == "help" {
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error()+". Run synchfolder help")
+		return exitUsage
+	}
+
+	command, ok := commands[name]
+
+	if !ok {
+		fmt.Fprintln(stderr, "unknown command "+name+". Run synchfolder help")
+		return exitUsage
+	}
+
+	if code := a.load(); code != exitOK {
+		return code
+	}
+
+	ctxLogger, cancelLogger := context.WithCancel(context.Background())
+
+	stopped := make(chan struct{})
+
+	// starting logger
+	go func() {
+		logger.Logger(ctxLogger)
+		close(stopped)
+	}()
+
+	// messages of the command are written before the app exits
+	defer func() {
+		cancelLogger()
+		<-stopped
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	a.ctx = ctx
+
+	defer stopOnSignal(cancel, stderr)()
+
+	defer reopenOnHangup()()
+
+	return command(a, fs.Args())
+}
+
+// func cancels the app on the first SIGINT or SIGTERM, so no new operations are started and
+// the command returns after copies in progress. The second signal exits at once.
+// The returned func stops listening to signals
+func stopOnSignal(cancel context.CancelFunc, stderr io.Writer) func() {
+
+	var logInfo logger.LogMessage = logger.LogMessage{LogType: logger.LogInfo, Ref: "main", Message: ""}
+
+	signals := make(chan os.Signal, 2)
+	done := make(chan struct{})
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+
+		select {
+
+		case sig := <-signals:
+
+			logInfo.Message = "stop on " + sig.String()
+			logger.Send(logInfo)
+
+			fmt.Fprintln(stderr, "stopping after operations in progress, send the signal again to exit at once")
+
+			cancel()
+
+		case <-done:
+			return
+		}
+
+		select {
+
+		case <-signals:
+
+			fmt.Fprintln(stderr, "exit without waiting for operations in progress")
+
+			os.Exit(exitInterrupted)
+
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// func opens the log file again on every SIGHUP, so the log may be rotated by other programs.
+// The returned func stops listening to the signal
+func reopenOnHangup() func() {
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+
+		for {
+			select {
+
+			case <-signals:
+				logger.Reopen()
+
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// func returns the outputs of the logger for the sinks of the config. Sinks without a level use the log level
+func logOutputs(cfg *utils.Config, logPath string, stderr io.Writer) []logger.Output {
+
+	outputs := []logger.Output{}
+
+	for _, sink := range cfg.LogSinks {
+
+		out := logger.Output{Level: sink.Level}
+
+		if out.Level == "" {
+			out.Level = logger.LogLevel
+		}
+
+		switch sink.Name {
+		case logger.SinkConsole:
+			out.Sink = logger.NewConsoleSink(stderr, cfg.LogColor)
+
+		case logger.SinkSyslog:
+			out.Sink = logger.NewSyslogSink(logger.SyslogSocket, "synchfolder")
+
+		case logger.SinkJournald:
+			out.Sink = logger.NewJournaldSink(logger.JournaldSocket, "synchfolder")
+
+		default:
+			out.Sink = logger.NewFileSink(logPath)
+		}
+
+		outputs = append(outputs, out)
+	}
+
+	return outputs
+}
+
+// func finds the config and the log, reads the config and makes jobs of it
+func (a *app) load() int {
+
+	configPath := a.opts.config
+
+	if configPath == "" {
+		configPath = findConfig()
+	}
+
+	// source and synch folders may be given without a config
+	if configPath == "" && (a.opts.source == "" || a.opts.dest == "") {
+		fmt.Fprintln(a.stderr, "config is not found. Set it with --config or set --source and --dest")
+		return exitConfig
+	}
+
+	utils.ConfigPath = configPath
+
+	logPath := a.opts.log
+
+	if logPath == "" && configPath != "" {
+		logPath = filepath.Join(filepath.Dir(filepath.Dir(configPath)), "logs", "log.txt")
+	}
+
+	if logPath == "" {
+		logPath = filepath.Join("logs", "log.txt")
+	}
+
+	logPath, _ = filepath.Abs(logPath)
+
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		fmt.Fprintln(a.stderr, "error creating log folder: "+err.Error())
+		return exitConfig
+	}
+
+	logger.LogPath = logPath
+	a.logs = filepath.Dir(logPath)
+
+	cfg, err := utils.LoadConfigWith(configPath, a.overrides())
+
+	if err != nil {
+		fmt.Fprintln(a.stderr, "Error reading "+filepath.Base(configPath)+":\n"+err.Error())
+		return exitConfig
+	}
+
+	_ = logger.SetLogLevel(cfg.LogLevel)
+	_ = logger.SetLogFormat(cfg.LogFormat)
+	_ = logger.SetOverflow(cfg.LogOverflow)
+
+	logger.MaxSize = cfg.LogMaxSize
+	logger.Daily = cfg.LogDaily
+	logger.Keep = cfg.LogKeep
+	logger.Outputs = logOutputs(cfg, logPath, a.stderr)
+
+	a.cfg = cfg
+
+	for _, jc := range cfg.Jobs {
+
+		if a.opts.job == "" || jc.Name == a.opts.job {
+			a.configs = append(a.configs, jc)
+		}
+	}
+
+	if len(a.configs) == 0 {
+		fmt.Fprintln(a.stderr, "job "+a.opts.job+" is not found in config")
+		return exitUsage
+	}
+
+	pool := synch.NewPoolLimits(cfg.Workers, cfg.Meta) //all jobs share the workers
+
+	for _, jc := range a.configs {
+
+		job := newJob(jc, cfg.Workers, cfg.Meta, len(a.configs), pool)
+		job.Drain = cfg.Shutdown
+
+		a.jobs = append(a.jobs, job)
+	}
+
+	return exitOK
+}
+
+// func returns config keys set by flags. With several jobs folders are set for the job of --job
+func (a *app) overrides() map[string]string {
+
+	flags := map[string]string{}
+
+	prefix := ""
+
+	if a.opts.job != "" && a.opts.job != utils.DefaultJob {
+		prefix = "jobs." + a.opts.job + "."
+	}
+
+	if a.opts.source != "" {
+		flags[prefix+"sourcepath"] = a.opts.source
+	}
+
+	if a.opts.dest != "" {
+		flags[prefix+"synchpath"] = a.opts.dest
+	}
+
+	if a.opts.report != "" {
+		flags["report"] = a.opts.report
+	}
+
+	return flags
+}
+
+// func returns the first config found in configs folders of the working folder or next to the app:
+// config.txt, config.yaml, config.yml, config.json or config.toml. "" is returned if nothing is found
+func findConfig() string {
+
+	dirs := []string{"configs"}
+
+	if exe, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Join(filepath.Dir(exe), "configs"), filepath.Join(filepath.Dir(exe), "..", "configs"))
+	}
+
+	for _, dir := range dirs {
+
+		for _, name := range []string{"config.txt", "config.yaml", "config.yml", "config.json", "config.toml"} {
+
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				path, _ := filepath.Abs(filepath.Join(dir, name))
+				return path
+			}
+		}
+	}
+
+	return ""
+}
+
+// func synchronizes folders until every job is stopped after a critical error or the app is stopped by a signal
+func runCommand(a *app, args []string) int {
+
+	if len(args) > 0 {
+		fmt.Fprintln(a.stderr, "run has no arguments. Run synchfolder help")
+		return exitUsage
+	}
+
+	// dry run of the config is the diff command
+	if a.cfg.DryRun {
+		return diffCommand(a, args)
+	}
+
+	if code := a.open(); code != exitOK {
+		return code
+	}
+
+	logger.Send(logger.LogMessage{LogType: logger.LogInfo, Ref: "main", Message: "start"}) //log app start
+
+	serve(a.ctx, a.jobs, a.configs)
+
+	// stopped by a signal, not by errors
+	if a.ctx.Err() != nil {
+		logger.Send(logger.LogMessage{LogType: logger.LogInfo, Ref: "main", Message: "stop"})
+		return exitOK
+	}
+
+	return exitFailed
+}
+
+// func checks folders once with --once, otherwise it is the run command. After the check
+// it prints a summary of every job and fails if any operation failed
+func syncCommand(a *app, args []string) int {
+
+	if !a.opts.once {
+		return runCommand(a, args)
+	}
+
+	if len(args) > 0 {
+		fmt.Fprintln(a.stderr, "sync has no arguments. Run synchfolder help")
+		return exitUsage
+	}
+
+	// a dry run config never writes, sync --once is the diff command too
+	if a.cfg.DryRun {
+		return diffCommand(a, args)
+	}
+
+	if code := a.open(); code != exitOK {
+		return code
+	}
+
+	summaries := make([]synch.Summary, len(a.jobs))
+
+	var wg sync.WaitGroup
+
+	for i, job := range a.jobs {
+
+		wg.Add(1)
+
+		go func(i int, job *synch.Job) {
+
+			defer wg.Done()
+
+			summaries[i] = once(a.ctx, job, a.stderr)
+
+		}(i, job)
+	}
+
+	wg.Wait()
+
+	var total synch.Summary
+
+	for i, job := range a.jobs {
+
+		if len(a.jobs) > 1 {
+			fmt.Fprint(a.stdout, "job "+job.Name+": ")
+		}
+
+		_ = summaries[i].Write(a.stdout)
+
+		total.Add(summaries[i])
+	}
+
+	if len(a.jobs) > 1 {
+		fmt.Fprint(a.stdout, "total: ")
+		_ = total.Write(a.stdout)
+	}
+
+	if total.Errors > 0 {
+		return exitFailed
+	}
+
+	return exitOK
+}
+
+// func checks the folders of the job once and prints failed operations and entries that couldn't be read
+// to errOut. Operations that are not done because the app is stopped are counted as errors
+func once(ctx context.Context, job *synch.Job, errOut io.Writer) synch.Summary {
+
+	start := time.Now()
+
+	check, err := job.Check(ctx)
+
+	saveState(job)
+
+	// the check couldn't be made at all
+	if err != nil {
+		fmt.Fprintln(errOut, "job "+job.Name+": "+err.Error())
+		return synch.Summary{Errors: 1, Duration: time.Since(start)}
+	}
+
+	summary := check.Summary
+	summary.Duration = time.Since(start)
+
+	for _, path := range check.Plan.ErrorPaths() {
+		fmt.Fprintln(errOut, "job "+job.Name+": "+path+": "+check.Plan.Errors[path].Error())
+	}
+
+	skipped := 0
+
+	for _, result := range check.Results {
+
+		if errors.Is(result.Err, context.Canceled) {
+			skipped++
+			continue
+		}
+
+		if result.Err != nil {
+			fmt.Fprintln(errOut, "job "+job.Name+": "+result.Op.Type+" "+result.Op.Path+": "+result.Err.Error())
+		}
+	}
+
+	if skipped > 0 {
+		fmt.Fprintln(errOut, "job "+job.Name+": the check is stopped, "+strconv.Itoa(skipped)+" operations are not done")
+	}
+
+	return summary
+}
+
+// func prints the changes that would be made in synch folders without changing anything.
+// If report is set the changes are written to the file
+func diffCommand(a *app, args []string) int {
+
+	if len(args) > 0 {
+		fmt.Fprintln(a.stderr, "diff has no arguments. Run synchfolder help")
+		return exitUsage
+	}
+
+	out := a.stdout
+
+	if a.cfg.Report != "" {
+
+		file, err := os.Create(a.cfg.Report)
+
+		if err != nil {
+			fmt.Fprintln(a.stderr, "error writing report: "+err.Error())
+			return exitFailed
+		}
+
+		defer file.Close()
+
+		out = file
+	}
+
+	code := exitOK
+
+	for _, job := range a.jobs {
+
+		// with one job the report stays as it was before jobs
+		if len(a.jobs) > 1 {
+			fmt.Fprintln(out, "job "+job.Name+":")
+		}
+
+		plan, err := job.DryRun()
+
+		if err != nil {
+			fmt.Fprintln(a.stderr, "diff of job "+job.Name+" failed: "+err.Error())
+			code = exitFailed
+			continue
+		}
+
+		if err = plan.Write(out); err != nil {
+			fmt.Fprintln(a.stderr, "error writing report: "+err.Error())
+			return exitFailed
+		}
+	}
+
+	return code
+}
+
+// func compares content of every file with its copy, ignoring the state of synchronized files,
+// and prints the differences without changing anything
+func verifyCommand(a *app, args []string) int {
+
+	if len(args) > 0 {
+		fmt.Fprintln(a.stderr, "verify has no arguments. Run synchfolder help")
+		return exitUsage
+	}
+
+	code := exitOK
+
+	for _, job := range a.jobs {
+
+		check := *job
+		check.Compare = synch.CompareSHA256
+		check.State = nil
+
+		plan, err := check.DryRun()
+
+		if err != nil {
+			fmt.Fprintln(a.stderr, "verify of job "+job.Name+" failed: "+err.Error())
+			code = exitFailed
+			continue
+		}
+
+		if len(plan.Ops) == 0 {
+			fmt.Fprintln(a.stdout, "job "+job.Name+": "+job.Slave+" is the same as "+job.Master)
+			continue
+		}
+
+		fmt.Fprintln(a.stdout, "job "+job.Name+": "+job.Slave+" differs from "+job.Master)
+
+		if err = plan.Write(a.stdout); err != nil {
+			fmt.Fprintln(a.stderr, "error writing differences: "+err.Error())
+			return exitFailed
+		}
+
+		if code == exitOK {
+			code = exitDiffer
+		}
+	}
+
+	return code
+}
+
+// func prints folders, the state and the trash of every job
+func statusCommand(a *app, args []string) int {
+
+	if len(args) > 0 {
+		fmt.Fprintln(a.stderr, "status has no arguments. Run synchfolder help")
+		return exitUsage
+	}
+
+	if code := a.openStores(); code != exitOK {
+		return code
+	}
+
+	for i, job := range a.jobs {
+
+		jc := a.configs[i]
+
+		fmt.Fprintln(a.stdout, "job "+job.Name+":")
+		fmt.Fprintln(a.stdout, "  source: "+job.Master)
+		fmt.Fprintln(a.stdout, "  synch:  "+job.Slave)
+		fmt.Fprintln(a.stdout, "  mode:   "+jc.Mode)
+
+		if job.State != nil {
+
+			count, last := job.State.Stats()
+
+			synced := "never"
+
+			if !last.IsZero() {
+				synced = last.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(a.stdout, "  state:  %d files, last synchronized %s\n", count, synced)
+		}
+
+		if job.Trash != nil {
+
+			stamps, _ := job.Trash.Stamps()
+			size, _ := job.Trash.Size()
+
+			fmt.Fprintf(a.stdout, "  trash:  %s, %d folders, %d bytes\n", job.Trash.Root, len(stamps), size)
+		}
+	}
+
+	return exitOK
+}
+
+// func copies a file or folder from the trash back to the source folder, so it is synchronized again.
+// args are the path relative to the synch folder and optionally the name of the trash folder
+func restoreCommand(a *app, args []string) int {
+
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(a.stderr, "usage: synchfolder restore [--job <name>] <path in synch folder> [trash folder]")
+		return exitUsage
+	}
+
+	if len(a.jobs) > 1 {
+		fmt.Fprintln(a.stderr, "there are several jobs. Choose one with --job")
+		return exitUsage
+	}
+
+	if code := a.openStores(); code != exitOK {
+		return code
+	}
+
+	if err := restore(a.jobs[0], args); err != nil {
+		fmt.Fprintln(a.stderr, err.Error())
+		return exitFailed
+	}
+
+	fmt.Fprintln(a.stdout, args[0]+" restored to "+filepath.Join(a.jobs[0].Master, args[0]))
+
+	return exitOK
+}
+
+// func prepares every job to run: cleans temporary files and the trash, opens state and trash and lets the breakers go on with --force
+func (a *app) open() int {
+
+	for i, job := range a.jobs {
+
+		if err := openJob(job, a.configs[i], a.logs); err != nil {
+			fmt.Fprintln(a.stderr, "job "+job.Name+": "+err.Error())
+			return exitFailed
+		}
+
+		// the operator checked the source folder and lets the first aborted check go on
+		if a.opts.force {
+			job.Breaker.Override()
+		}
+	}
+
+	return exitOK
+}
+
+// func opens the index and the trash of every job for commands that don't change the folders.
+// Temporary files of copies in progress and the trash are not cleaned
+func (a *app) openStores() int {
+
+	for i, job := range a.jobs {
+
+		if err := openStores(job, a.configs[i], a.logs); err != nil {
+			fmt.Fprintln(a.stderr, "job "+job.Name+": "+err.Error())
+			return exitFailed
+		}
+	}
+
+	return exitOK
+}
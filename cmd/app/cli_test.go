@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCliFlags(t *testing.T) {
+
+	req := require.New(t)
+
+	source := t.TempDir()
+	dest := t.TempDir()
+	log := t.TempDir() + "/log.txt"
+
+	cases := map[string]struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		"flags after the command": {
+			args:   []string{"status", "--source", source, "--dest", dest, "--log", log},
+			stdout: "  source: " + source + "\n",
+		},
+
+		"flags before the command": {
+			args:   []string{"--source", source, "--dest", dest, "--log", log, "status"},
+			stdout: "  source: " + source + "\n",
+		},
+
+		"flags on both sides": {
+			args:   []string{"--source", source, "status", "--dest", dest, "--log", log},
+			stdout: "  synch:  " + dest + "\n",
+		},
+
+		"help after flags": {
+			args:   []string{"--log", log, "help"},
+			stdout: "Usage: synchfolder",
+		},
+
+		"unknown command after flags": {
+			args:   []string{"--log", log, "stat"},
+			code:   exitUsage,
+			stderr: "unknown command stat. Run synchfolder help",
+		},
+
+		"unknown flag before the command": {
+			args:   []string{"--verbose", "status"},
+			code:   exitUsage,
+			stderr: "flag provided but not defined: -verbose. Run synchfolder help",
+		},
+
+		"arguments of a command without them": {
+			args:   []string{"--source", source, "--dest", dest, "--log", log, "status", "now"},
+			code:   exitUsage,
+			stderr: "status has no arguments",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			var stdout, stderr bytes.Buffer
+
+			req.Equal(cs.code, cli(cs.args, &stdout, &stderr), stderr.String())
+			req.Contains(stdout.String(), cs.stdout)
+			req.Contains(stderr.String(), cs.stderr)
+		})
+	}
+
+}
+
+func TestCliDryRun(t *testing.T) {
+
+	req := require.New(t)
+
+	source := t.TempDir()
+	dest := t.TempDir()
+	config := t.TempDir() + "/config.txt"
+	log := t.TempDir() + "/log.txt"
+
+	req.NoError(os.WriteFile(source+"/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(config, []byte("sourcepath="+source+"\nsynchpath="+dest+"\ndryrun=true\n"), 0644))
+
+	for _, args := range [][]string{{"sync", "--once"}, {"run"}} {
+
+		var stdout, stderr bytes.Buffer
+
+		req.Equal(exitOK, cli(append(args, "--config", config, "--log", log), &stdout, &stderr), stderr.String())
+
+		// the changes are printed, nothing is written
+		req.Contains(stdout.String(), "1 operations, 1 COPY")
+
+		_, err := os.Stat(dest + "/file1")
+		req.ErrorIs(err, os.ErrNotExist)
+	}
+
+}
+
+func TestCliCritical(t *testing.T) {
+
+	req := require.New(t)
+
+	source := t.TempDir()
+	dest := t.TempDir()
+	config := t.TempDir() + "/config.txt"
+	log := t.TempDir() + "/log.txt"
+
+	req.NoError(os.WriteFile(dest+"/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(dest+"/file2", []byte("test"), 0644))
+	req.NoError(os.WriteFile(config, []byte("sourcepath="+source+"\nsynchpath="+dest+"\nabortcount=1\n"), 0644))
+
+	var stdout, stderr bytes.Buffer
+
+	// the breaker stops the only job
+	req.Equal(exitFailed, cli([]string{"run", "--config", config, "--log", log}, &stdout, &stderr), stderr.String())
+
+	// the stop is logged, not printed
+	req.NotContains(stdout.String(), "stopped")
+
+	data, err := os.ReadFile(log)
+	req.NoError(err)
+	req.Contains(string(data), "job is stopped after a critical error")
+
+	_, err = os.Stat(dest + "/file1")
+	req.NoError(err)
+
+}
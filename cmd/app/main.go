@@ -1,87 +1,353 @@
-package main
-
-import (
-	"context"
-	"fmt"
-	"path/filepath"
-	"sync"
-	"synchfolder/internal/logger"
-	"synchfolder/internal/synch"
-	"synchfolder/internal/utils"
-	"time"
-)
-
-func main() {
-
-	var root string //root path
-
-	var cfgMap map[string]string //map for config storing
-
-	var wgMain sync.WaitGroup
-
-	logInfo := logger.LogMessage{LogType: logger.LogInfo, Ref: "main", Message: "start"} //struct for log message storing type INFO
-
-	//initialising paths
-
-	root, _ = filepath.Abs("./")
-	logger.LogPath = root + "/logs/log.txt"
-	utils.ConfigPath = root + "/configs/config.txt"
-
-	ctxLogger, cancelLogger := context.WithCancel(context.Background())
-
-	// starting logger
-	go func() {
-		logger.Logger(ctxLogger)
-	}()
-
-	defer func() {
-		cancelLogger()
-	}()
-
-	cfgMap, err := utils.GetConfig() //read config.txt
-
-	if err != nil {
-		fmt.Println("Error reading config.txt. App terminated")
-		return
-	}
-
-	if err = logger.SetLogLevel(cfgMap["loglevel"]); err != nil {
-		fmt.Println(err.Error())
-	}
-
-	logger.LogChan <- logInfo //log app start
-
-L:
-	for {
-
-		select {
-
-		case <-synch.CriticalChan:
-
-			fmt.Println("application is closed unexpectedly")
-
-			break L
-
-		default:
-			wgMain.Add(1)
-
-			go func() {
-				defer wgMain.Done()
-				_ = synch.CheckMasterFolder(cfgMap["sourcepath"], cfgMap["synchpath"])
-			}()
-
-			wgMain.Add(1)
-
-			go func() {
-				defer wgMain.Done()
-				_ = synch.CheckSlaveFolder(cfgMap["sourcepath"], cfgMap["synchpath"])
-			}()
-
-			wgMain.Wait()
-
-			time.Sleep(3 * time.Second)
-
-		}
-	}
-
-}
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"synchfolder/internal/logger"
+	"synchfolder/internal/state"
+	"synchfolder/internal/synch"
+	"synchfolder/internal/trash"
+	"synchfolder/internal/utils"
+	"synchfolder/internal/watcher"
+	"time"
+)
+
+func main() {
+
+	os.Exit(cli(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// func runs every job in its own goroutine until all of them are stopped after critical errors or ctx is done
+func serve(ctx context.Context, jobs []*synch.Job, configs []*utils.JobConfig) {
+
+	var wg sync.WaitGroup
+
+	for i, job := range jobs {
+
+		wg.Add(1)
+
+		go func(job *synch.Job, jc *utils.JobConfig) {
+
+			defer wg.Done()
+
+			run(ctx, job, jc)
+
+		}(job, configs[i])
+	}
+
+	wg.Wait()
+}
+
+// func checks the job in its mode until a critical error of the job or until ctx is done
+func run(ctx context.Context, job *synch.Job, jc *utils.JobConfig) {
+
+	logError := logger.LogMessage{LogType: logger.LogError, Ref: "run", Job: job.Name, Message: ""}
+
+	if jc.Mode == "watch" {
+
+		err := watch(ctx, job, jc.Reconcile)
+
+		if err == nil {
+			return
+		}
+
+		logError.Message = "watch mode is not available, polling is used: " + err.Error()
+		logger.Send(logError)
+	}
+
+	poll(ctx, job, jc.Interval)
+}
+
+// func returns the job of the config. Values are already validated. If there are several jobs
+// a job gets a half of the workers, so others always find free workers
+func newJob(jc *utils.JobConfig, workers, meta, count int, pool *synch.Pool) *synch.Job {
+
+	preserve, _ := synch.ParsePreserve(strings.Join(jc.Preserve, ","))
+
+	if count > 1 && workers > 1 {
+		workers /= 2
+	}
+
+	if count > 1 && meta > 1 {
+		meta /= 2
+	}
+
+	return &synch.Job{
+		Name:   jc.Name,
+		Master: jc.SourcePath,
+		Slave:  jc.SynchPath,
+		Options: synch.Options{
+			Compare:      jc.Compare,
+			Preserve:     preserve,
+			Symlinks:     jc.Symlinks,
+			Specials:     jc.Specials,
+			HardLinks:    jc.HardLinks,
+			MaxDeletions: jc.MaxDeletions,
+			Workers:      workers,
+			MetaWorkers:  meta,
+			Pool:         pool,
+			Breaker:      &synch.Breaker{MaxCount: jc.AbortCount, MaxPercent: jc.AbortPercent, Sentinel: jc.Sentinel},
+			Filter: &synch.Filter{
+				Include:        jc.Include,
+				Exclude:        jc.Exclude,
+				IgnoreFile:     jc.IgnoreFile,
+				MinSize:        jc.MinSize,
+				MaxSize:        jc.MaxSize,
+				MinAge:         jc.MinAge,
+				MaxAge:         jc.MaxAge,
+				DeleteExcluded: jc.DeleteExcluded,
+			},
+		},
+		Critical: make(chan struct{}, 2),
+	}
+}
+
+// func prepares the job to run: removes files of interrupted copies, opens its index and trash,
+// removes old entries of the trash and records the device of the source folder
+func openJob(job *synch.Job, jc *utils.JobConfig, logs string) error {
+
+	_ = job.CleanTempFiles() //remove files of copies interrupted by a crash
+
+	if err := openStores(job, jc, logs); err != nil {
+		return err
+	}
+
+	if err := job.Breaker.RecordDevice(job.Master); err != nil {
+		logger.Send(logger.LogMessage{LogType: logger.LogError, Ref: "openJob", Job: job.Name,
+			Message: "device of source folder is not known: " + err.Error()})
+	}
+
+	if job.Trash != nil {
+		job.CleanTrash()
+	}
+
+	return nil
+}
+
+// func opens the index and the trash of the job without changing the folders, so commands that only
+// read them may run next to the app. The index of the default job is state.json in the logs folder,
+// others are state-<name>.json
+func openStores(job *synch.Job, jc *utils.JobConfig, logs string) error {
+
+	statePath := logs + "/state.json"
+
+	if job.Name != utils.DefaultJob {
+		statePath = logs + "/state-" + job.Name + ".json"
+	}
+
+	var err error
+
+	job.State, err = state.Open(statePath)
+
+	if err != nil {
+		logger.Send(logger.LogMessage{LogType: logger.LogError, Ref: "openStores", Job: job.Name, Message: err.Error()})
+	}
+
+	if jc.Trash == "" {
+		return nil
+	}
+
+	job.Trash, err = trash.Open(jc.Trash, jc.TrashAge, jc.TrashSize)
+
+	return err
+}
+
+// func copies a file or folder from the trash of the job back to the source folder.
+// args are the path relative to the synch folder and optionally the name of the trash folder
+func restore(job *synch.Job, args []string) error {
+
+	logInfo := logger.LogMessage{LogType: logger.LogInfo, Ref: "restore", Job: job.Name, Message: ""}
+
+	if job.Trash == nil {
+		return errors.New("trash is not set in config. Nothing to restore")
+	}
+
+	var at time.Time
+
+	if len(args) > 1 {
+
+		var err error
+
+		at, err = time.ParseInLocation(trash.StampLayout, args[1], time.UTC)
+
+		if err != nil {
+			return errors.New("wrong trash folder " + args[1] + ". It looks like " + trash.StampLayout)
+		}
+	}
+
+	dest := filepath.Join(job.Master, args[0])
+
+	if err := job.Trash.Restore(args[0], at, dest); err != nil {
+		return errors.New("error restoring " + args[0] + ": " + err.Error())
+	}
+
+	logInfo.Message = args[0] + " restored from trash to " + dest
+	logger.Send(logInfo)
+
+	return nil
+}
+
+// func checks source and synch folders of the job every interval until a critical error or until ctx is done
+func poll(ctx context.Context, job *synch.Job, interval time.Duration) {
+
+	for {
+
+		select {
+
+		case <-ctx.Done():
+
+			return
+
+		case <-job.Critical:
+
+			logger.Send(logger.Critical("poll", "job is stopped after a critical error").WithJob(job.Name))
+
+			return
+
+		default:
+
+			synchronize(ctx, job)
+
+			if !sleep(ctx, interval) {
+				return
+			}
+
+		}
+	}
+}
+
+// func waits for d and returns false if ctx is done before
+func sleep(ctx context.Context, d time.Duration) bool {
+
+	timer := time.NewTimer(d)
+
+	defer timer.Stop()
+
+	select {
+
+	case <-timer.C:
+		return true
+
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// func checks folders of source reported by inotify and the whole tree every reconcile period
+// until a critical error or until ctx is done. An error is returned if the watcher stops before ctx is done
+func watch(ctx context.Context, job *synch.Job, period time.Duration) error {
+
+	logError := logger.LogMessage{LogType: logger.LogError, Ref: "watch", Job: job.Name, Message: ""}
+
+	if period <= 0 {
+		period = 10 * time.Minute
+	}
+
+	w, err := watcher.New(job.Master, 500*time.Millisecond)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	defer cancel()
+
+	go w.Run(ctx)
+
+	synchronize(ctx, job)
+
+	ticker := time.NewTicker(period)
+
+	defer ticker.Stop()
+
+	for {
+
+		select {
+
+		case <-ctx.Done():
+
+			return nil
+
+		case <-job.Critical:
+
+			logger.Send(logger.Critical("watch", "job is stopped after a critical error").WithJob(job.Name))
+
+			return nil
+
+		case batch, ok := <-w.Events:
+
+			if !ok {
+				return watchStopped(ctx, w, logError)
+			}
+
+			if batch.Rescan {
+				synchronize(ctx, job)
+
+			} else {
+				_ = job.CheckFoldersContext(ctx, batch.Folders)
+				saveState(job)
+			}
+
+		case err := <-w.Errors:
+
+			logError.Message = err.Error()
+			logger.Send(logError)
+
+		case <-ticker.C:
+
+			synchronize(ctx, job)
+
+		}
+	}
+}
+
+// func logs the errors left by the stopped watcher. The error is nil if the watcher is stopped by ctx
+func watchStopped(ctx context.Context, w *watcher.Watcher, logError logger.LogMessage) error {
+
+	for {
+
+		select {
+
+		case err := <-w.Errors:
+
+			logError.Message = err.Error()
+			logger.Send(logError)
+
+		default:
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return errors.New("events of the source folder are not read any more")
+		}
+	}
+}
+
+// func checks the whole source and synch folders of the job. The state is saved also when the check is stopped
+func synchronize(ctx context.Context, job *synch.Job) {
+
+	_, _ = job.SynchContext(ctx)
+
+	saveState(job)
+}
+
+// func writes the index of synchronized files of the job to disk
+func saveState(job *synch.Job) {
+
+	logError := logger.LogMessage{LogType: logger.LogError, Ref: "saveState", Job: job.Name, Message: ""}
+
+	if job.State == nil {
+		return
+	}
+
+	if err := job.State.Save(); err != nil {
+		logError.Message = "error saving state: " + err.Error()
+		logger.Send(logError)
+	}
+}
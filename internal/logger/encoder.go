@@ -0,0 +1,197 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formats of the log file
+const (
+	FormatText   string = "text"
+	FormatJSON   string = "json"
+	FormatLogfmt string = "logfmt"
+)
+
+// Encoder turns a message into one line of the log
+type Encoder interface {
+	// func appends the line of the message with its newline to buf and returns it
+	Encode(buf []byte, message LogMessage) []byte
+}
+
+// encoders of the log formats
+var encoders = map[string]Encoder{
+	FormatText:   TextEncoder{},
+	FormatJSON:   JSONEncoder{},
+	FormatLogfmt: LogfmtEncoder{},
+}
+
+// func returns the encoder of the log format, text if the format is unknown
+func encoder() Encoder {
+
+	if enc, ok := encoders[LogFormat]; ok {
+		return enc
+	}
+
+	return TextEncoder{}
+}
+
+// TextEncoder writes messages for people:
+// 2024-05-01T10:00:00+02:00 - INFO - FUNC: execute; JOB: photos; LOG: file copied; PATH: /copy/a.jpg; BYTES: 1024;
+type TextEncoder struct{}
+
+func (TextEncoder) Encode(buf []byte, message LogMessage) []byte {
+
+	buf = append(buf, message.Time.Format(time.RFC3339)...)
+	buf = append(buf, " - "+message.LogType+" - "...)
+	buf = textFields(buf, message)
+
+	return append(buf, '\n')
+}
+
+// func appends the fields of the message in the text format without the time and the type:
+// FUNC: execute; JOB: photos; LOG: file copied;
+func textFields(buf []byte, message LogMessage) []byte {
+
+	buf = append(buf, "FUNC: "+message.Ref+"; "...)
+
+	field := func(name, value string) {
+		if value != "" {
+			buf = append(buf, name+": "+value+"; "...)
+		}
+	}
+
+	field("JOB", message.Job)
+	field("LOG", message.Message)
+	field("PATH", message.Path)
+	field("OP", message.Op)
+
+	if message.Bytes != 0 {
+		field("BYTES", strconv.FormatInt(message.Bytes, 10))
+	}
+
+	if message.Duration != 0 {
+		field("DURATION", message.Duration.String())
+	}
+
+	if message.Err != nil {
+		field("ERROR", message.Err.Error())
+	}
+
+	// the last field ends without a space
+	return buf[:len(buf)-1]
+}
+
+// JSONEncoder writes a JSON object on every line
+type JSONEncoder struct{}
+
+// jsonRecord is the JSON object of a message
+type jsonRecord struct {
+	Time     string  `json:"time"`
+	Level    string  `json:"level"`
+	Ref      string  `json:"func,omitempty"`
+	Job      string  `json:"job,omitempty"`
+	Message  string  `json:"msg"`
+	Path     string  `json:"path,omitempty"`
+	Op       string  `json:"op,omitempty"`
+	Bytes    int64   `json:"bytes,omitempty"`
+	Duration float64 `json:"duration_ms,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+func (JSONEncoder) Encode(buf []byte, message LogMessage) []byte {
+
+	record := jsonRecord{
+		Time:     message.Time.Format(time.RFC3339),
+		Level:    message.LogType,
+		Ref:      message.Ref,
+		Job:      message.Job,
+		Message:  message.Message,
+		Path:     message.Path,
+		Op:       message.Op,
+		Bytes:    message.Bytes,
+		Duration: milliseconds(message.Duration),
+	}
+
+	if message.Err != nil {
+		record.Error = message.Err.Error()
+	}
+
+	out := bytes.NewBuffer(buf)
+
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+
+	// a record of strings and numbers is always encoded
+	_ = enc.Encode(record)
+
+	return out.Bytes()
+}
+
+// LogfmtEncoder writes key=value pairs on every line, values with spaces or quotes are quoted
+type LogfmtEncoder struct{}
+
+func (LogfmtEncoder) Encode(buf []byte, message LogMessage) []byte {
+
+	first := true
+
+	field := func(key, value string) {
+
+		if !first {
+			buf = append(buf, ' ')
+		}
+
+		first = false
+
+		buf = append(buf, key+"="...)
+
+		if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+			buf = strconv.AppendQuote(buf, value)
+		} else {
+			buf = append(buf, value...)
+		}
+	}
+
+	field("time", message.Time.Format(time.RFC3339))
+	field("level", message.LogType)
+
+	if message.Ref != "" {
+		field("func", message.Ref)
+	}
+
+	if message.Job != "" {
+		field("job", message.Job)
+	}
+
+	field("msg", message.Message)
+
+	if message.Path != "" {
+		field("path", message.Path)
+	}
+
+	if message.Op != "" {
+		field("op", message.Op)
+	}
+
+	if message.Bytes != 0 {
+		field("bytes", strconv.FormatInt(message.Bytes, 10))
+	}
+
+	if message.Duration != 0 {
+		field("duration_ms", strconv.FormatFloat(milliseconds(message.Duration), 'f', -1, 64))
+	}
+
+	if message.Err != nil {
+		field("error", message.Err.Error())
+	}
+
+	return append(buf, '\n')
+}
+
+// func returns the duration in milliseconds with microseconds
+func milliseconds(d time.Duration) float64 {
+
+	return float64(d.Microseconds()) / 1000
+}
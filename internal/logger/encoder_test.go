@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoders(t *testing.T) {
+
+	req := require.New(t)
+
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	copied := Info("execute", "file copied").WithJob("photos").WithPath("/copy/a b.jpg").WithOp("COPY").
+		WithBytes(1024).WithDuration(1500 * time.Microsecond)
+	copied.Time = at
+
+	failed := Error("execute", "COPY failed").WithPath("/copy/c.jpg").WithErr(errors.New(`open "c.jpg": denied`))
+	failed.Time = at
+
+	cases := map[string]struct {
+		encoder Encoder
+		lines   []string
+	}{
+		"text": {
+			encoder: TextEncoder{},
+			lines: []string{
+				"2024-05-01T10:00:00+02:00 - INFO - FUNC: execute; JOB: photos; LOG: file copied; PATH: /copy/a b.jpg; OP: COPY; BYTES: 1024; DURATION: 1.5ms;\n",
+				`2024-05-01T10:00:00+02:00 - ERROR - FUNC: execute; LOG: COPY failed; PATH: /copy/c.jpg; ERROR: open "c.jpg": denied;` + "\n",
+			},
+		},
+
+		"json": {
+			encoder: JSONEncoder{},
+			lines: []string{
+				`{"time":"2024-05-01T10:00:00+02:00","level":"INFO","func":"execute","job":"photos","msg":"file copied","path":"/copy/a b.jpg","op":"COPY","bytes":1024,"duration_ms":1.5}` + "\n",
+				`{"time":"2024-05-01T10:00:00+02:00","level":"ERROR","func":"execute","msg":"COPY failed","path":"/copy/c.jpg","error":"open \"c.jpg\": denied"}` + "\n",
+			},
+		},
+
+		"logfmt": {
+			encoder: LogfmtEncoder{},
+			lines: []string{
+				`time=2024-05-01T10:00:00+02:00 level=INFO func=execute job=photos msg="file copied" path="/copy/a b.jpg" op=COPY bytes=1024 duration_ms=1.5` + "\n",
+				`time=2024-05-01T10:00:00+02:00 level=ERROR func=execute msg="COPY failed" path=/copy/c.jpg error="open \"c.jpg\": denied"` + "\n",
+			},
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			req.Equal(cs.lines[0], string(cs.encoder.Encode(nil, copied)))
+			req.Equal(cs.lines[1], string(cs.encoder.Encode(nil, failed)))
+
+			// lines are appended to the buffer
+			req.Equal(cs.lines[0]+cs.lines[1], string(cs.encoder.Encode(cs.encoder.Encode(nil, copied), failed)))
+		})
+	}
+
+	// every JSON line is an object
+	var record map[string]interface{}
+	req.NoError(json.Unmarshal(JSONEncoder{}.Encode(nil, copied), &record))
+	req.Equal(1024.0, record["bytes"])
+
+}
+
+func TestSetLogFormat(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { LogFormat = FormatText }()
+
+	req.NoError(SetLogFormat("JSON"))
+	req.Equal(FormatJSON, LogFormat)
+	req.Equal(JSONEncoder{}, encoder())
+
+	req.EqualError(SetLogFormat("xml"), "unknown log format xml, it may be text, json or logfmt")
+	req.Equal(FormatJSON, LogFormat)
+
+}
@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// journaldSink sends every message to journald at once in its native protocol
+type journaldSink struct {
+	socket
+	identifier string
+	buf        []byte
+}
+
+// func returns a sink that sends messages to journald listening on the unix socket path.
+// Messages get the syslog identifier, other fields of the message are sent as SYNCH_ fields
+func NewJournaldSink(path, identifier string) Sink {
+
+	return &journaldSink{socket: socket{path: path}, identifier: identifier}
+}
+
+// func sends the message as KEY=VALUE lines, empty fields are not sent
+func (j *journaldSink) Write(message LogMessage) error {
+
+	j.buf = j.buf[:0]
+
+	j.field("MESSAGE", message.Message)
+	j.field("PRIORITY", strconv.Itoa(severity(message.LogType)))
+	j.field("SYSLOG_IDENTIFIER", j.identifier)
+	j.field("CODE_FUNC", message.Ref)
+	j.field("SYNCH_JOB", message.Job)
+	j.field("SYNCH_PATH", message.Path)
+	j.field("SYNCH_OP", message.Op)
+
+	if message.Bytes != 0 {
+		j.field("SYNCH_BYTES", strconv.FormatInt(message.Bytes, 10))
+	}
+
+	if message.Duration != 0 {
+		j.field("SYNCH_DURATION_MS", strconv.FormatFloat(milliseconds(message.Duration), 'f', -1, 64))
+	}
+
+	if message.Err != nil {
+		j.field("SYNCH_ERROR", message.Err.Error())
+	}
+
+	return j.send(j.buf)
+}
+
+// func appends the field to the buffer. A value with a newline is sent as the key, a newline,
+// its length as a little endian uint64 and the value
+func (j *journaldSink) field(key, value string) {
+
+	if value == "" {
+		return
+	}
+
+	if !strings.Contains(value, "\n") {
+		j.buf = append(j.buf, key+"="+value+"\n"...)
+		return
+	}
+
+	j.buf = append(j.buf, key+"\n"...)
+	j.buf = binary.LittleEndian.AppendUint64(j.buf, uint64(len(value)))
+	j.buf = append(j.buf, value+"\n"...)
+}
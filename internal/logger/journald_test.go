@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournaldSink(t *testing.T) {
+
+	req := require.New(t)
+
+	path := t.TempDir() + "/journal.sock"
+	conn := listen(t, path)
+
+	sink := NewJournaldSink(path, "synchfolder")
+	defer sink.Close()
+
+	cases := map[string]struct {
+		message LogMessage
+		fields  string
+	}{
+		"info": {
+			message: Info("execute", "file copied").WithJob("photos").WithPath("/copy/a.jpg").WithOp("COPY").
+				WithBytes(1024).WithDuration(1500 * time.Microsecond),
+			fields: "MESSAGE=file copied\nPRIORITY=6\nSYSLOG_IDENTIFIER=synchfolder\nCODE_FUNC=execute\n" +
+				"SYNCH_JOB=photos\nSYNCH_PATH=/copy/a.jpg\nSYNCH_OP=COPY\nSYNCH_BYTES=1024\nSYNCH_DURATION_MS=1.5\n",
+		},
+
+		"error": {
+			message: Error("execute", "COPY failed").WithErr(errors.New("denied")),
+			fields:  "MESSAGE=COPY failed\nPRIORITY=3\nSYSLOG_IDENTIFIER=synchfolder\nCODE_FUNC=execute\nSYNCH_ERROR=denied\n",
+		},
+
+		// a value with a newline is sent with its length
+		"multiline": {
+			message: Critical("main", "stop\nnow"),
+			fields:  "MESSAGE\n\x08\x00\x00\x00\x00\x00\x00\x00stop\nnow\nPRIORITY=2\nSYSLOG_IDENTIFIER=synchfolder\nCODE_FUNC=main\n",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			req.NoError(sink.Write(cs.message))
+			req.Equal(cs.fields, receive(t, conn))
+		})
+	}
+
+}
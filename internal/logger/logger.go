@@ -1,107 +1,377 @@
-package logger
-
-import (
-	"bufio"
-	"context"
-	"errors"
-	"os"
-	"strings"
-	"time"
-)
-
-const (
-	LogError    string = "ERROR"
-	LogInfo     string = "INFO"
-	LogCritical string = "CRITICAL"
-)
-
-type LogMessage struct {
-	LogType string
-	Ref     string
-	Message string
-}
-
-var LogChan chan LogMessage
-
-var LogPath, LogLevel string
-
-func init() {
-	LogChan = make(chan LogMessage, 100)
-	LogLevel = LogError
-
-}
-
-func log(logtype, ref, message string) error {
-
-	logfile, err := os.OpenFile(LogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-
-	if err != nil {
-		return err
-	}
-
-	defer logfile.Close()
-
-	t := time.Now()
-
-	str := t.Format("02-01-2006 15:04:05") + " - " + logtype + " - FUNC: " + ref + "; LOG: " + message + ";\n"
-
-	w := bufio.NewWriter(logfile)
-
-	_, err = w.WriteString(str)
-
-	if err != nil {
-		return err
-	}
-
-	w.Flush()
-
-	return nil
-}
-
-func Logger(ctx context.Context) {
-	logfile, _ := os.OpenFile(LogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	logfile.Close()
-
-	defer close(LogChan)
-
-	for {
-		select {
-		case message := <-LogChan:
-
-			switch {
-			case LogLevel == LogInfo:
-				_ = log(message.LogType, message.Ref, message.Message)
-
-			case LogLevel == LogError:
-				if message.LogType != LogInfo {
-					_ = log(message.LogType, message.Ref, message.Message)
-
-				}
-			case LogLevel == LogCritical:
-				if message.LogType == LogCritical {
-					_ = log(message.LogType, message.Ref, message.Message)
-				}
-
-			}
-
-		case <-ctx.Done():
-
-			return
-		}
-	}
-}
-
-func SetLogLevel(logLevel string) error {
-
-	logLevel = strings.ToUpper(logLevel)
-
-	if logLevel == LogInfo || logLevel == LogError || logLevel == LogCritical {
-		LogLevel = logLevel
-
-	} else {
-		return errors.New("log level is not set in config. Default log level ERROR")
-	}
-
-	return nil
-
-}
+package logger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	LogError    string = "ERROR"
+	LogInfo     string = "INFO"
+	LogCritical string = "CRITICAL"
+)
+
+// LogMessage is a log record. Fields that are not set are not written
+type LogMessage struct {
+	LogType  string
+	Ref      string
+	Message  string
+	Job      string        // name of the sync job the message is about, empty for the app itself
+	Time     time.Time     // when the message is made, the time it is written if it is zero
+	Path     string        // file or folder the message is about
+	Op       string        // operation, like COPY or RMDIR
+	Bytes    int64         // bytes copied
+	Duration time.Duration // how long the operation took
+	Err      error
+}
+
+var LogChan chan LogMessage
+
+var LogPath, LogLevel, LogFormat string
+
+// how often the logger writes its messages to the log file
+var FlushInterval time.Duration
+
+// gets failures of writing the log file
+var Stderr io.Writer
+
+func init() {
+	LogChan = make(chan LogMessage, 100)
+	LogLevel = LogError
+	LogFormat = FormatText
+	FlushInterval = time.Second
+	Stderr = os.Stderr
+
+}
+
+// func returns an info message of the func ref made now
+func Info(ref, message string) LogMessage {
+
+	return LogMessage{LogType: LogInfo, Ref: ref, Message: message, Time: time.Now()}
+}
+
+// func returns an error message of the func ref made now
+func Error(ref, message string) LogMessage {
+
+	return LogMessage{LogType: LogError, Ref: ref, Message: message, Time: time.Now()}
+}
+
+// func returns a critical message of the func ref made now
+func Critical(ref, message string) LogMessage {
+
+	return LogMessage{LogType: LogCritical, Ref: ref, Message: message, Time: time.Now()}
+}
+
+// func returns the message of the job
+func (m LogMessage) WithJob(job string) LogMessage {
+
+	m.Job = job
+
+	return m
+}
+
+// func returns the message about the file or folder
+func (m LogMessage) WithPath(path string) LogMessage {
+
+	m.Path = path
+
+	return m
+}
+
+// func returns the message about the operation
+func (m LogMessage) WithOp(op string) LogMessage {
+
+	m.Op = op
+
+	return m
+}
+
+// func returns the message with the number of copied bytes
+func (m LogMessage) WithBytes(bytes int64) LogMessage {
+
+	m.Bytes = bytes
+
+	return m
+}
+
+// func returns the message with the time the operation took
+func (m LogMessage) WithDuration(duration time.Duration) LogMessage {
+
+	m.Duration = duration
+
+	return m
+}
+
+// func returns the message with the error
+func (m LogMessage) WithErr(err error) LogMessage {
+
+	m.Err = err
+
+	return m
+}
+
+// logFile is the open log file. Lines are kept in a buffer and written to the file when it is flushed.
+// The file is rotated by MaxSize and Daily
+type logFile struct {
+	path string
+	file *os.File
+	size int64
+	day  string // day of the first line of the file
+	buf  []byte
+}
+
+// func returns a sink that appends messages in the log format to the file at path
+func NewFileSink(path string) Sink {
+
+	return &logFile{path: path}
+}
+
+// func appends the message to the buffer in the log format
+func (f *logFile) Write(message LogMessage) error {
+
+	f.buf = encoder().Encode(f.buf, message)
+
+	return nil
+}
+
+// func writes the buffer to the file, the file is opened if it isn't open yet and rotated if it is full.
+// Lines that can't be written are dropped, so a broken disk doesn't use up the memory
+func (f *logFile) Flush() error {
+
+	if len(f.buf) == 0 && f.file != nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	var rotateErr error
+
+	err := f.open()
+
+	// a failed rotation is reported, the lines are still written
+	if err == nil && f.full(now) {
+		rotateErr = f.rotate()
+		err = f.open()
+	}
+
+	if err == nil {
+
+		if f.size == 0 {
+			f.day = day(now)
+		}
+
+		var n int
+
+		n, err = f.file.Write(f.buf)
+		f.size += int64(n)
+	}
+
+	f.buf = f.buf[:0]
+
+	if err != nil {
+
+		// the file is opened again on the next flush
+		_ = f.Close()
+
+		return err
+	}
+
+	return rotateErr
+}
+
+// func writes the buffer to the file and opens the file at the path again
+func (f *logFile) Reopen() error {
+
+	err := f.Flush()
+
+	_ = f.Close()
+
+	if openErr := f.open(); err == nil {
+		err = openErr
+	}
+
+	return err
+}
+
+// func opens the log file for appending
+func (f *logFile) open() error {
+
+	if f.file != nil {
+		return nil
+	}
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.day = day(info.ModTime())
+
+	return nil
+}
+
+// func closes the log file
+func (f *logFile) Close() error {
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+// func writes messages of LogChan to the outputs until ctx is done. Outputs keep their files and sockets open,
+// messages are written in batches every FlushInterval, critical messages at once. Outputs are opened again
+// after Reopen. Messages that are already sent when ctx is done are written before it returns, later messages
+// are dropped. Dropped messages are counted in the log
+func Logger(ctx context.Context) {
+
+	outputs := openOutputs()
+
+	defer closeOutputs(outputs)
+
+	start()
+
+	ticker := time.NewTicker(FlushInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message := <-LogChan:
+
+			write(outputs, message)
+
+			if message.LogType == LogCritical {
+				syncOutputs(outputs)
+			}
+
+		case <-ticker.C:
+
+			if message, ok := droppedMessage(); ok {
+				write(outputs, message)
+			}
+
+			syncOutputs(outputs)
+
+		case <-reopen:
+
+			for _, out := range outputs {
+				out.reopen()
+			}
+
+		case <-ctx.Done():
+
+			// senders don't wait any more, then the rest of messages is written
+			stop()
+
+			flush(outputs)
+
+			if message, ok := droppedMessage(); ok {
+				write(outputs, message)
+			}
+
+			syncOutputs(outputs)
+
+			return
+		}
+	}
+}
+
+// func writes the messages waiting in LogChan without waiting for new ones
+func flush(outputs []*output) {
+
+	for {
+		select {
+		case message := <-LogChan:
+			write(outputs, message)
+
+		default:
+			return
+		}
+	}
+}
+
+// func writes the message to every output whose level allows its type
+func write(outputs []*output, message LogMessage) {
+
+	if message.Time.IsZero() {
+		message.Time = time.Now()
+	}
+
+	for _, out := range outputs {
+
+		if !allowed(out.Level, message.LogType) {
+			continue
+		}
+
+		// buffered sinks fail on flush, a failure isn't cleared before that
+		if err := out.Sink.Write(message); err != nil {
+			out.report(err)
+		}
+	}
+}
+
+// func checks if messages of the type are written at the level
+func allowed(level, logType string) bool {
+
+	switch {
+	case level == LogInfo:
+		return true
+
+	case level == LogError:
+		return logType != LogInfo
+
+	case level == LogCritical:
+		return logType == LogCritical
+
+	}
+
+	return false
+}
+
+func SetLogLevel(logLevel string) error {
+
+	logLevel = strings.ToUpper(logLevel)
+
+	if logLevel == LogInfo || logLevel == LogError || logLevel == LogCritical {
+		LogLevel = logLevel
+
+	} else {
+		return errors.New("log level is not set in config. Default log level ERROR")
+	}
+
+	return nil
+
+}
+
+// func sets the format of the log file: text, json or logfmt
+func SetLogFormat(format string) error {
+
+	format = strings.ToLower(format)
+
+	if _, ok := encoders[format]; !ok {
+		return errors.New("unknown log format " + format + ", it may be text, json or logfmt")
+	}
+
+	LogFormat = format
+
+	return nil
+}
@@ -1,88 +1,268 @@
-package logger
-
-import (
-	"path/filepath"
-	"testing"
-
-	"github.com/stretchr/testify/require"
-)
-
-func TestSetLogLevel(t *testing.T) {
-	req := require.New(t)
-
-	cases := map[string]struct {
-		logLevel string
-		isError  bool
-		errMsg   string
-	}{
-		"success INFO": {
-			logLevel: "INFO",
-		},
-
-		"success ERROR": {
-			logLevel: "ERROR",
-		},
-
-		"success CRITICAL": {
-			logLevel: "CRITICAL",
-		},
-
-		"wrong log level": {
-			logLevel: "SOMETHING",
-			isError:  true,
-			errMsg:   "log level is not set in config. Default log level ERROR",
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			err := SetLogLevel(cs.logLevel)
-
-			if cs.isError {
-				req.Error(err)
-				req.Contains(err.Error(), cs.errMsg)
-			} else {
-				req.NoError(err)
-			}
-		})
-	}
-
-}
-
-func TestLog(t *testing.T) {
-
-	req := require.New(t)
-	root, _ := filepath.Abs("../../")
-
-	cases := map[string]struct {
-		path    string
-		isError bool
-	}{
-		"success": {
-
-			path: root + "/test/logger/testlog.txt",
-		},
-
-		"empty path": {
-			path:    "",
-			isError: true,
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			LogPath = cs.path
-			err := log("TEST", "testfunc", "test message")
-
-			if cs.isError {
-				req.Error(err)
-
-			} else {
-				req.NoError(err)
-			}
-		})
-	}
-
-}
+package logger
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	req := require.New(t)
+
+	cases := map[string]struct {
+		logLevel string
+		isError  bool
+		errMsg   string
+	}{
+		"success INFO": {
+			logLevel: "INFO",
+		},
+
+		"success ERROR": {
+			logLevel: "ERROR",
+		},
+
+		"success CRITICAL": {
+			logLevel: "CRITICAL",
+		},
+
+		"wrong log level": {
+			logLevel: "SOMETHING",
+			isError:  true,
+			errMsg:   "log level is not set in config. Default log level ERROR",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := SetLogLevel(cs.logLevel)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+			}
+		})
+	}
+
+}
+
+func TestLog(t *testing.T) {
+
+	req := require.New(t)
+	root, _ := filepath.Abs("../../")
+
+	cases := map[string]struct {
+		path    string
+		isError bool
+	}{
+		"success": {
+
+			path: root + "/test/logger/testlog.txt",
+		},
+
+		"empty path": {
+			path:    "",
+			isError: true,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			f := &logFile{path: cs.path}
+			defer f.Close()
+
+			f.Write(Info("testfunc", "test message"))
+			err := f.Flush()
+
+			if cs.isError {
+				req.Error(err)
+
+			} else {
+				req.NoError(err)
+			}
+
+			// the buffer is empty after the flush, even if it failed
+			req.Empty(f.buf)
+		})
+	}
+
+}
+
+func TestLoggerErrors(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { Stderr = os.Stderr }()
+
+	var stderr bytes.Buffer
+	Stderr = &stderr
+
+	LogPath = t.TempDir() + "/missing/log.txt"
+	LogLevel = LogInfo
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		Logger(ctx)
+		close(done)
+	}()
+
+	LogChan <- Critical("main", "first")
+	LogChan <- Critical("main", "second")
+
+	// the logger reports why it can't write, the same failure once
+	req.Eventually(func() bool {
+		return len(LogChan) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	LogChan = make(chan LogMessage, 100)
+
+	req.Equal(1, strings.Count(stderr.String(), "log messages are lost: open "+LogPath+": no such file or directory\n"))
+
+}
+
+func TestLoggerJob(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { FlushInterval = time.Second }()
+
+	LogPath = t.TempDir() + "/log.txt"
+	LogLevel = LogInfo
+	FlushInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		Logger(ctx)
+		close(done)
+	}()
+
+	LogChan <- LogMessage{LogType: LogInfo, Ref: "execute", Job: "photos", Message: "file copied"}
+	LogChan <- LogMessage{LogType: LogInfo, Ref: "main", Message: "start"}
+
+	// the logger writes messages in order, the second is written when the file has both
+	req.Eventually(func() bool {
+		data, _ := os.ReadFile(LogPath)
+		return strings.Count(string(data), "\n") == 2
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	LogChan = make(chan LogMessage, 100)
+
+	data, err := os.ReadFile(LogPath)
+	req.NoError(err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	req.Contains(lines[0], " - INFO - FUNC: execute; JOB: photos; LOG: file copied;")
+	req.Contains(lines[1], " - INFO - FUNC: main; LOG: start;")
+
+	// the time of the message has its time zone
+	_, err = time.Parse(time.RFC3339, strings.SplitN(lines[0], " ", 2)[0])
+	req.NoError(err)
+
+}
+
+func TestLoggerFlush(t *testing.T) {
+
+	req := require.New(t)
+
+	LogPath = t.TempDir() + "/log.txt"
+	LogLevel = LogInfo
+
+	// messages sent before the logger stops are written, even if it had no time to read them
+	for i := 0; i < 50; i++ {
+		LogChan <- LogMessage{LogType: LogInfo, Ref: "main", Message: "shutdown"}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	Logger(ctx)
+
+	LogChan = make(chan LogMessage, 100)
+
+	data, err := os.ReadFile(LogPath)
+	req.NoError(err)
+	req.Equal(50, strings.Count(string(data), "LOG: shutdown;"))
+
+}
+
+// the logger keeps the file open and writes messages in batches,
+// the old way opened, wrote and closed the file for every message
+func BenchmarkLogger(b *testing.B) {
+
+	LogLevel = LogInfo
+
+	message := Info("execute", "file copied from /master/file").WithJob("photos").WithPath("/slave/file").WithOp("COPY").WithBytes(4096)
+
+	b.Run("open per message", func(b *testing.B) {
+
+		path := b.TempDir() + "/log.txt"
+
+		for i := 0; i < b.N; i++ {
+
+			file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			_, _ = file.Write(encoder().Encode(nil, message))
+			_ = file.Close()
+		}
+	})
+
+	b.Run("batched", func(b *testing.B) {
+
+		LogPath = b.TempDir() + "/log.txt"
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan struct{})
+
+		go func() {
+			Logger(ctx)
+			close(done)
+		}()
+
+		for i := 0; i < b.N; i++ {
+			LogChan <- message
+		}
+
+		// every message is written when the logger returns
+		cancel()
+		<-done
+
+		b.StopTimer()
+
+		LogChan = make(chan LogMessage, 100)
+
+		data, err := os.ReadFile(LogPath)
+
+		if err != nil || bytes.Count(data, []byte("\n")) != b.N {
+			b.Fatal("messages are lost", err)
+		}
+	})
+
+}
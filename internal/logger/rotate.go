@@ -0,0 +1,139 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// the log file is rotated when it gets bigger than MaxSize bytes, 0 is no limit
+var MaxSize int64
+
+// if it is set the log file is rotated when a new day begins
+var Daily bool
+
+// number of rotated log files that are kept: path.1.gz is the newest, older ones are deleted
+var Keep int
+
+// signals the logger to open the log file again
+var reopen chan struct{}
+
+func init() {
+	Keep = 7
+	reopen = make(chan struct{}, 1)
+}
+
+// func makes the logger close the log file and open it again, so the file may be moved by other programs
+// like logrotate. Messages of the logger are written to the old file until it is open again
+func Reopen() {
+
+	select {
+	case reopen <- struct{}{}:
+	default:
+	}
+}
+
+// func returns the day of t for daily rotation
+func day(t time.Time) string {
+
+	return t.Format("2006-01-02")
+}
+
+// func checks if the buffer must be written to a new log file
+func (f *logFile) full(now time.Time) bool {
+
+	if f.file == nil || f.size == 0 {
+		return false
+	}
+
+	return MaxSize > 0 && f.size+int64(len(f.buf)) > MaxSize || Daily && day(now) != f.day
+}
+
+// func moves the log file to path.1.gz and older rotated files one generation up.
+// The file is moved aside first, so the next flush starts a new file even if the rest fails.
+// A file that can't be compressed is kept next to the log, it is never overwritten
+func (f *logFile) rotate() error {
+
+	_ = f.Close()
+
+	// nothing is kept, archives of a bigger Keep too
+	if Keep == 0 {
+		_ = os.Remove(generation(f.path, 1))
+		return os.Remove(f.path)
+	}
+
+	rotated := f.path + "." + time.Now().Format("20060102T150405.000000000")
+
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+
+	for n := Keep; n > 0; n-- {
+
+		if err := os.Rename(generation(f.path, n), generation(f.path, n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// the oldest generation is dropped
+	_ = os.Remove(generation(f.path, Keep+1))
+
+	if err := compress(rotated, generation(f.path, 1)); err != nil {
+		return err
+	}
+
+	return os.Remove(rotated)
+}
+
+// func returns the path of the rotated log file of the generation
+func generation(path string, n int) string {
+
+	return path + "." + strconv.Itoa(n) + ".gz"
+}
+
+// func writes the gzip archive of the file at path to dest, dest is not changed if it fails
+func compress(path, dest string) (err error) {
+
+	in, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	// the archive is renamed to dest when it is complete
+	tmp := dest + ".tmp"
+
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err == nil {
+			err = os.Rename(tmp, dest)
+		}
+
+		// a broken archive isn't kept
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	zw := gzip.NewWriter(out)
+
+	if _, err = io.Copy(zw, in); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
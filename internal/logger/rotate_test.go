@@ -0,0 +1,236 @@
+package logger
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// func returns the content of the rotated log file
+func readGzip(t *testing.T, path string) string {
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestRotate(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { MaxSize, Keep = 0, 7 }()
+
+	path := t.TempDir() + "/log.txt"
+
+	line := TextEncoder{}.Encode(nil, Info("main", "message 0"))
+
+	// every flush of two lines fills the file
+	MaxSize = int64(len(line)) * 2
+	Keep = 2
+
+	f := &logFile{path: path}
+	defer f.Close()
+
+	for i := 0; i < 8; i += 2 {
+		f.Write(Info("main", "message "+strconv.Itoa(i)))
+		f.Write(Info("main", "message "+strconv.Itoa(i+1)))
+		req.NoError(f.Flush())
+	}
+
+	data, err := os.ReadFile(path)
+	req.NoError(err)
+	req.Contains(string(data), "message 6;")
+	req.Contains(string(data), "message 7;")
+
+	// the newest rotated file is the first generation, older ones above Keep are deleted
+	req.Contains(readGzip(t, path+".1.gz"), "message 4;")
+	req.Contains(readGzip(t, path+".2.gz"), "message 2;")
+
+	_, err = os.Stat(path + ".3.gz")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	// only archives are left
+	files, err := filepath.Glob(path + ".*")
+	req.NoError(err)
+	req.ElementsMatch([]string{path + ".1.gz", path + ".2.gz"}, files)
+
+	// nothing is kept without generations
+	Keep = 0
+
+	f.Write(Info("main", "message 8"))
+	f.Write(Info("main", "message 9"))
+	req.NoError(f.Flush())
+
+	data, err = os.ReadFile(path)
+	req.NoError(err)
+	req.Equal(2, strings.Count(string(data), "\n"))
+
+	_, err = os.Stat(path + ".1.gz")
+	req.ErrorIs(err, os.ErrNotExist)
+
+}
+
+func TestRotateFailure(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { MaxSize, Keep = 0, 7 }()
+
+	path := t.TempDir() + "/log.txt"
+
+	line := TextEncoder{}.Encode(nil, Info("main", "message 0"))
+
+	MaxSize = int64(len(line)) * 2
+	Keep = 2
+
+	f := &logFile{path: path}
+	defer f.Close()
+
+	req.NoError(f.Write(Info("main", "message 0")))
+	req.NoError(f.Write(Info("main", "message 1")))
+	req.NoError(f.Flush())
+
+	// the archive can't be written
+	req.NoError(os.Mkdir(path+".1.gz.tmp", 0755))
+
+	req.NoError(f.Write(Info("main", "message 2")))
+	req.Error(f.Flush())
+
+	// the full file is kept aside, the new line starts a new file that isn't rotated again
+	req.NoError(f.Write(Info("main", "message 3")))
+	req.NoError(f.Flush())
+
+	leftovers, err := filepath.Glob(path + ".2*")
+	req.NoError(err)
+	req.Len(leftovers, 1)
+
+	data, err := os.ReadFile(leftovers[0])
+	req.NoError(err)
+	req.Equal(2, strings.Count(string(data), "\n"))
+	req.Contains(string(data), "message 0;")
+
+	data, err = os.ReadFile(path)
+	req.NoError(err)
+	req.Contains(string(data), "message 2;")
+	req.Contains(string(data), "message 3;")
+
+	_, err = os.Stat(path + ".1.gz")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	// the next rotation doesn't touch the kept file
+	req.NoError(os.Remove(path + ".1.gz.tmp"))
+
+	req.NoError(f.Write(Info("main", "message 4")))
+	req.NoError(f.Flush())
+
+	req.Contains(readGzip(t, path+".1.gz"), "message 3;")
+
+	data, err = os.ReadFile(leftovers[0])
+	req.NoError(err)
+	req.Contains(string(data), "message 1;")
+
+}
+
+func TestRotateDaily(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { Daily = false }()
+
+	Daily = true
+
+	path := t.TempDir() + "/log.txt"
+
+	// the file is written yesterday
+	req.NoError(os.WriteFile(path, []byte("yesterday\n"), 0644))
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	req.NoError(os.Chtimes(path, yesterday, yesterday))
+
+	f := &logFile{path: path}
+	defer f.Close()
+
+	f.Write(Info("main", "today"))
+	req.NoError(f.Flush())
+
+	f.Write(Info("main", "later today"))
+	req.NoError(f.Flush())
+
+	data, err := os.ReadFile(path)
+	req.NoError(err)
+	req.Equal(2, strings.Count(string(data), "today;"))
+
+	req.Equal("yesterday\n", readGzip(t, path+".1.gz"))
+
+}
+
+func TestReopen(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { FlushInterval = time.Second }()
+
+	LogPath = t.TempDir() + "/log.txt"
+	LogLevel = LogInfo
+	FlushInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		Logger(ctx)
+		close(done)
+	}()
+
+	LogChan <- Info("main", "before")
+
+	req.Eventually(func() bool {
+		data, _ := os.ReadFile(LogPath)
+		return strings.Contains(string(data), "before")
+	}, time.Second, 10*time.Millisecond)
+
+	// logrotate moves the file and tells the app to open it again
+	req.NoError(os.Rename(LogPath, LogPath+".old"))
+
+	Reopen()
+
+	req.Eventually(func() bool {
+		_, err := os.Stat(LogPath)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	LogChan <- Info("main", "after")
+
+	cancel()
+	<-done
+
+	LogChan = make(chan LogMessage, 100)
+
+	old, err := os.ReadFile(LogPath + ".old")
+	req.NoError(err)
+	req.Contains(string(old), "before")
+	req.NotContains(string(old), "after")
+
+	data, err := os.ReadFile(LogPath)
+	req.NoError(err)
+	req.Contains(string(data), "after")
+
+}
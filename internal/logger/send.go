@@ -0,0 +1,146 @@
+package logger
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// what Send does when LogChan is full
+const (
+	OverflowBlock      string = "block"       // wait until the logger takes a message
+	OverflowDropOldest string = "drop-oldest" // drop the oldest waiting message to make room
+	OverflowDropNewest string = "drop-newest" // drop the new message
+)
+
+// the overflow policy of Send
+var Overflow string
+
+// number of messages dropped since the start: by the overflow policy or because the logger is stopped
+var dropped uint64
+
+// number of dropped messages that are already counted in the log, only the logger changes it
+var reported uint64
+
+// state of the logger for senders
+var (
+	state   sync.RWMutex
+	stopped chan struct{} // closed when the logger returns, a new one is made when it starts
+)
+
+func init() {
+	Overflow = OverflowBlock
+	stopped = make(chan struct{})
+}
+
+// func sends the message to the logger by the overflow policy. It never panics: messages sent
+// when the logger is stopped are dropped, a sender that waits for room is released when the logger stops
+func Send(message LogMessage) {
+
+	state.RLock()
+	done := stopped
+	state.RUnlock()
+
+	select {
+	case <-done:
+		atomic.AddUint64(&dropped, 1)
+		return
+	default:
+	}
+
+	switch Overflow {
+
+	case OverflowDropNewest:
+
+		select {
+		case LogChan <- message:
+		default:
+			atomic.AddUint64(&dropped, 1)
+		}
+
+	case OverflowDropOldest:
+
+		for {
+			select {
+			case LogChan <- message:
+				return
+			default:
+			}
+
+			// the logger may take the oldest message first, then nothing is dropped
+			select {
+			case <-LogChan:
+				atomic.AddUint64(&dropped, 1)
+			default:
+			}
+		}
+
+	default:
+
+		select {
+		case LogChan <- message:
+		case <-done:
+			atomic.AddUint64(&dropped, 1)
+		}
+	}
+}
+
+// func returns the number of messages dropped since the start
+func Dropped() uint64 {
+
+	return atomic.LoadUint64(&dropped)
+}
+
+// func lets senders wait for the logger again after it was stopped
+func start() {
+
+	state.Lock()
+	defer state.Unlock()
+
+	select {
+	case <-stopped:
+		stopped = make(chan struct{})
+	default:
+	}
+}
+
+// func releases senders, from now on their messages are dropped
+func stop() {
+
+	state.Lock()
+	defer state.Unlock()
+
+	close(stopped)
+}
+
+// func returns a message about messages dropped since the last report
+func droppedMessage() (LogMessage, bool) {
+
+	count := Dropped()
+
+	if count == reported {
+		return LogMessage{}, false
+	}
+
+	message := Error("logger", strconv.FormatUint(count-reported, 10)+" log messages are dropped")
+
+	reported = count
+
+	return message, true
+}
+
+// func sets what Send does when LogChan is full: block, drop-oldest or drop-newest
+func SetOverflow(policy string) error {
+
+	policy = strings.ToLower(policy)
+
+	if policy != OverflowBlock && policy != OverflowDropOldest && policy != OverflowDropNewest {
+		return errors.New("unknown overflow policy " + policy + ", it may be block, drop-oldest or drop-newest")
+	}
+
+	Overflow = policy
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// func returns the messages waiting in LogChan
+func waiting() []string {
+
+	messages := []string{}
+
+	for len(LogChan) > 0 {
+		messages = append(messages, (<-LogChan).Message)
+	}
+
+	return messages
+}
+
+func TestSendOverflow(t *testing.T) {
+
+	req := require.New(t)
+
+	// other tests stop the logger
+	start()
+
+	defer func() {
+		Overflow = OverflowBlock
+		LogChan = make(chan LogMessage, 100)
+	}()
+
+	cases := map[string]struct {
+		policy   string
+		messages []string
+	}{
+		"drop newest": {
+			policy:   OverflowDropNewest,
+			messages: []string{"0", "1", "2"},
+		},
+
+		"drop oldest": {
+			policy:   OverflowDropOldest,
+			messages: []string{"2", "3", "4"},
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			req.NoError(SetOverflow(cs.policy))
+
+			// nobody reads the channel, it is full after 3 messages
+			LogChan = make(chan LogMessage, 3)
+
+			before := Dropped()
+
+			for i := 0; i < 5; i++ {
+				Send(Info("main", strconv.Itoa(i)))
+			}
+
+			req.Equal(cs.messages, waiting())
+			req.Equal(uint64(2), Dropped()-before)
+		})
+	}
+
+	req.EqualError(SetOverflow("wait"), "unknown overflow policy wait, it may be block, drop-oldest or drop-newest")
+
+}
+
+func TestSendBlock(t *testing.T) {
+
+	req := require.New(t)
+
+	start()
+
+	defer func() {
+		LogChan = make(chan LogMessage, 100)
+		start()
+	}()
+
+	LogChan = make(chan LogMessage, 1)
+
+	Send(Info("main", "0"))
+
+	sent := make(chan struct{})
+
+	go func() {
+		Send(Info("main", "1"))
+		close(sent)
+	}()
+
+	// the sender waits for room
+	select {
+	case <-sent:
+		req.Fail("the message is sent to a full channel")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// it sends when the logger takes a message
+	req.Equal("0", (<-LogChan).Message)
+
+	<-sent
+
+	req.Equal([]string{"1"}, waiting())
+
+	// a waiting sender is released when the logger stops
+	Send(Info("main", "2"))
+
+	sent = make(chan struct{})
+
+	go func() {
+		Send(Info("main", "3"))
+		close(sent)
+	}()
+
+	before := Dropped()
+
+	time.Sleep(10 * time.Millisecond)
+	stop()
+
+	<-sent
+
+	req.Equal(uint64(1), Dropped()-before)
+	req.Equal([]string{"2"}, waiting())
+
+}
+
+func TestSendAfterShutdown(t *testing.T) {
+
+	req := require.New(t)
+
+	start()
+
+	defer func() {
+		FlushInterval = time.Second
+		Overflow = OverflowBlock
+		start()
+	}()
+
+	LogPath = t.TempDir() + "/log.txt"
+	LogLevel = LogInfo
+	FlushInterval = 10 * time.Millisecond
+
+	// messages dropped while nobody reads the full channel are counted in the log
+	LogChan = make(chan LogMessage, 2)
+	Overflow = OverflowDropNewest
+	reported = Dropped()
+
+	for i := 0; i < 5; i++ {
+		Send(Info("main", "saturated"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		Logger(ctx)
+		close(done)
+	}()
+
+	req.Eventually(func() bool {
+		data, _ := os.ReadFile(LogPath)
+		return strings.Contains(string(data), "3 log messages are dropped")
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	// the channel is not closed, later messages are dropped without waiting
+	Overflow = OverflowBlock
+
+	before := Dropped()
+
+	for i := 0; i < 5; i++ {
+		Send(Critical("main", "late"))
+	}
+
+	req.Equal(uint64(5), Dropped()-before)
+	req.Empty(waiting())
+
+	LogChan = make(chan LogMessage, 100)
+
+	data, err := os.ReadFile(LogPath)
+	req.NoError(err)
+	req.Equal(2, strings.Count(string(data), "saturated"))
+	req.NotContains(string(data), "late")
+
+}
@@ -0,0 +1,159 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+)
+
+// names of the sinks in the config
+const (
+	SinkFile     string = "file"
+	SinkConsole  string = "console"
+	SinkSyslog   string = "syslog"
+	SinkJournald string = "journald"
+)
+
+// Sink is where the logger writes its messages. Only the logger uses a sink, it needs no locks
+type Sink interface {
+	// func takes the message, the sink may keep it until it is flushed
+	Write(message LogMessage) error
+	// func writes the messages the sink keeps
+	Flush() error
+	// func flushes the sink and frees its files and sockets, the sink opens them again when it is written
+	Close() error
+}
+
+// reopener is a sink that opens its file again after Reopen
+type reopener interface {
+	Reopen() error
+}
+
+// Output is a sink with the minimum level of its messages
+type Output struct {
+	Sink  Sink
+	Level string
+}
+
+// sinks of the logger, the file at LogPath with LogLevel if it is empty
+var Outputs []Output
+
+// output is an output of the running logger
+type output struct {
+	Output
+	failed string // the last failure reported to Stderr
+}
+
+// func returns the outputs of the logger and opens them, so their failures are reported at the start
+func openOutputs() []*output {
+
+	outputs := []*output{}
+
+	for _, out := range Outputs {
+		outputs = append(outputs, &output{Output: out})
+	}
+
+	if len(outputs) == 0 {
+		outputs = append(outputs, &output{Output: Output{Sink: NewFileSink(LogPath), Level: LogLevel}})
+	}
+
+	syncOutputs(outputs)
+
+	return outputs
+}
+
+// func flushes every output
+func syncOutputs(outputs []*output) {
+
+	for _, out := range outputs {
+		out.report(out.Sink.Flush())
+	}
+}
+
+// func closes every output
+func closeOutputs(outputs []*output) {
+
+	for _, out := range outputs {
+		out.report(out.Sink.Close())
+	}
+}
+
+// func flushes the output and opens it again if its sink can do it
+func (o *output) reopen() {
+
+	if sink, ok := o.Sink.(reopener); ok {
+		o.report(sink.Reopen())
+		return
+	}
+
+	o.report(o.Sink.Flush())
+}
+
+// func reports a new failure of the output to Stderr. The logger can't log its own errors
+func (o *output) report(err error) {
+
+	if err == nil {
+		o.failed = ""
+		return
+	}
+
+	if err.Error() != o.failed {
+		o.failed = err.Error()
+		fmt.Fprintln(Stderr, "log messages are lost: "+err.Error())
+	}
+}
+
+// console colors of the message types, info messages are not colored
+var colors = map[string]string{
+	LogError:    "\x1b[31m",
+	LogCritical: "\x1b[1;31m",
+}
+
+// consoleSink writes messages in the log format to a terminal
+type consoleSink struct {
+	w     io.Writer
+	color bool
+	buf   []byte
+}
+
+// func returns a sink that writes messages in the log format to w, errors are colored if color is set
+func NewConsoleSink(w io.Writer, color bool) Sink {
+
+	return &consoleSink{w: w, color: color}
+}
+
+// func appends the line of the message to the buffer
+func (c *consoleSink) Write(message LogMessage) error {
+
+	code, ok := colors[message.LogType]
+
+	if !c.color || !ok {
+		c.buf = encoder().Encode(c.buf, message)
+		return nil
+	}
+
+	c.buf = append(c.buf, code...)
+	c.buf = encoder().Encode(c.buf, message)
+
+	// the color is reset before the newline
+	c.buf = append(c.buf[:len(c.buf)-1], "\x1b[0m\n"...)
+
+	return nil
+}
+
+// func writes the buffer to the terminal
+func (c *consoleSink) Flush() error {
+
+	if len(c.buf) == 0 {
+		return nil
+	}
+
+	_, err := c.w.Write(c.buf)
+	c.buf = c.buf[:0]
+
+	return err
+}
+
+func (c *consoleSink) Close() error {
+
+	return c.Flush()
+}
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsoleSink(t *testing.T) {
+
+	req := require.New(t)
+
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	info := Info("main", "start")
+	info.Time = at
+
+	failed := Error("execute", "COPY failed")
+	failed.Time = at
+
+	stop := Critical("main", "stop")
+	stop.Time = at
+
+	cases := map[string]struct {
+		color bool
+		out   string
+	}{
+		"plain": {
+			out: "2024-05-01T10:00:00+02:00 - INFO - FUNC: main; LOG: start;\n" +
+				"2024-05-01T10:00:00+02:00 - ERROR - FUNC: execute; LOG: COPY failed;\n" +
+				"2024-05-01T10:00:00+02:00 - CRITICAL - FUNC: main; LOG: stop;\n",
+		},
+
+		"color": {
+			color: true,
+			out: "2024-05-01T10:00:00+02:00 - INFO - FUNC: main; LOG: start;\n" +
+				"\x1b[31m2024-05-01T10:00:00+02:00 - ERROR - FUNC: execute; LOG: COPY failed;\x1b[0m\n" +
+				"\x1b[1;31m2024-05-01T10:00:00+02:00 - CRITICAL - FUNC: main; LOG: stop;\x1b[0m\n",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			var out bytes.Buffer
+
+			sink := NewConsoleSink(&out, cs.color)
+
+			req.NoError(sink.Write(info))
+			req.NoError(sink.Write(failed))
+			req.NoError(sink.Write(stop))
+
+			// lines are written when the sink is flushed
+			req.Empty(out.String())
+
+			req.NoError(sink.Flush())
+			req.Equal(cs.out, out.String())
+		})
+	}
+
+}
+
+func TestOutputs(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { Outputs = nil }()
+
+	path := t.TempDir() + "/log.txt"
+	conn := listen(t, t.TempDir()+"/log.sock")
+
+	var console bytes.Buffer
+
+	// every sink has its own level, LogLevel is not used
+	LogLevel = LogCritical
+
+	// messages dropped by other tests are not counted
+	reported = Dropped()
+
+	Outputs = []Output{
+		{Sink: NewFileSink(path), Level: LogInfo},
+		{Sink: NewConsoleSink(&console, false), Level: LogError},
+		{Sink: NewSyslogSink(conn.LocalAddr().String(), "synchfolder"), Level: LogCritical},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		Logger(ctx)
+		close(done)
+	}()
+
+	LogChan <- Info("main", "start")
+	LogChan <- Error("main", "failed")
+	LogChan <- Critical("main", "stop")
+
+	req.Contains(receive(t, conn), "LOG: stop;")
+
+	cancel()
+	<-done
+
+	data, err := os.ReadFile(path)
+	req.NoError(err)
+	req.Equal(3, strings.Count(string(data), "\n"))
+
+	req.NotContains(console.String(), "start")
+	req.Contains(console.String(), "LOG: failed;")
+	req.Contains(console.String(), "LOG: stop;")
+
+}
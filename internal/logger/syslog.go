@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sockets of the local syslog daemon and of journald
+const (
+	SyslogSocket   string = "/dev/log"
+	JournaldSocket string = "/run/systemd/journal/socket"
+)
+
+// syslog facility of the messages: daemon
+const facility = 3
+
+// syslog severities of the message types
+var severities = map[string]int{
+	LogInfo:     6,
+	LogError:    3,
+	LogCritical: 2,
+}
+
+// socket is a unix datagram socket that is dialed when it is first written
+type socket struct {
+	path string
+	conn net.Conn
+}
+
+// func sends the datagram, the socket is dialed again once if the daemon was restarted
+func (s *socket) send(data []byte) error {
+
+	for try := 0; ; try++ {
+
+		err := s.dial()
+
+		if err == nil {
+			_, err = s.conn.Write(data)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		_ = s.Close()
+
+		if try > 0 {
+			return err
+		}
+	}
+}
+
+// func dials the socket if it isn't open yet
+func (s *socket) dial() error {
+
+	if s.conn != nil {
+		return nil
+	}
+
+	conn, err := net.Dial("unixgram", s.path)
+
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+
+	return nil
+}
+
+// func dials the socket, so a missing daemon is reported at the start
+func (s *socket) Flush() error {
+
+	return s.dial()
+}
+
+func (s *socket) Close() error {
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
+
+// syslogSink sends every message to the local syslog daemon at once
+type syslogSink struct {
+	socket
+	tag string
+	pid string
+	buf []byte
+}
+
+// func returns a sink that sends messages to the syslog daemon listening on the unix socket path.
+// Messages are tagged with tag and the pid of the app
+func NewSyslogSink(path, tag string) Sink {
+
+	return &syslogSink{socket: socket{path: path}, tag: tag, pid: strconv.Itoa(os.Getpid())}
+}
+
+// func sends the message as <PRI>Stamp tag[pid]: FUNC: ref; LOG: message;
+func (s *syslogSink) Write(message LogMessage) error {
+
+	s.buf = append(s.buf[:0], '<')
+	s.buf = strconv.AppendInt(s.buf, int64(facility*8+severity(message.LogType)), 10)
+	s.buf = append(s.buf, '>')
+	s.buf = message.Time.AppendFormat(s.buf, time.Stamp)
+	s.buf = append(s.buf, " "+s.tag+"["+s.pid+"]: "...)
+	s.buf = textFields(s.buf, message)
+
+	return s.send(s.buf)
+}
+
+// func returns the syslog severity of the message type
+func severity(logType string) int {
+
+	if severity, ok := severities[logType]; ok {
+		return severity
+	}
+
+	return severities[LogInfo]
+}
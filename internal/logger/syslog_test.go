@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// func listens on a unix datagram socket at path like a syslog daemon or journald
+func listen(t *testing.T, path string) *net.UnixConn {
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// func returns the next datagram of the socket
+func receive(t *testing.T, conn *net.UnixConn) string {
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+
+	buf := make([]byte, 4096)
+
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+
+	return string(buf[:n])
+}
+
+func TestSyslogSink(t *testing.T) {
+
+	req := require.New(t)
+
+	path := t.TempDir() + "/log.sock"
+
+	sink := NewSyslogSink(path, "synchfolder")
+	defer sink.Close()
+
+	// the daemon isn't running yet
+	req.Error(sink.Flush())
+
+	conn := listen(t, path)
+
+	req.NoError(sink.Flush())
+
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	tag := "synchfolder[" + strconv.Itoa(os.Getpid()) + "]: "
+
+	cases := map[string]struct {
+		message LogMessage
+		line    string
+	}{
+		"info": {
+			message: Info("execute", "file copied").WithJob("photos").WithPath("/copy/a.jpg"),
+			line:    "<30>May  1 10:00:00 " + tag + "FUNC: execute; JOB: photos; LOG: file copied; PATH: /copy/a.jpg;",
+		},
+
+		"error": {
+			message: Error("execute", "COPY failed"),
+			line:    "<27>May  1 10:00:00 " + tag + "FUNC: execute; LOG: COPY failed;",
+		},
+
+		"critical": {
+			message: Critical("main", "stop"),
+			line:    "<26>May  1 10:00:00 " + tag + "FUNC: main; LOG: stop;",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			cs.message.Time = at
+
+			req.NoError(sink.Write(cs.message))
+			req.Equal(cs.line, receive(t, conn))
+		})
+	}
+
+	// the sink dials again when the daemon is restarted
+	conn.Close()
+	req.NoError(os.Remove(path))
+
+	conn = listen(t, path)
+
+	req.NoError(sink.Write(Info("main", "restarted")))
+	req.Contains(receive(t, conn), "LOG: restarted;")
+
+}
@@ -0,0 +1,254 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is the last known state of a file
+type Entry struct {
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mtime"`
+	Mode    os.FileMode `json:"mode"`
+	Synced  time.Time   `json:"synced"`
+}
+
+// DB is an index of files by path that is stored on disk between runs. It lets a check skip the content
+// comparison of files that are not changed since they were synchronized. It doesn't find changed files
+// by itself: folders are still read every check, only the watch mode reads just the folders with changes
+type DB struct {
+	path     string
+	mu       sync.RWMutex
+	entries  map[string]Entry
+	children map[string]map[string]bool // stored paths and the folders above them by their parent folder
+	dirty    bool
+}
+
+// func opens the index stored at path. If the file does not exist an empty index is returned
+func Open(path string) (*DB, error) {
+
+	db := &DB{path: path, entries: map[string]Entry{}, children: map[string]map[string]bool{}}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return db, nil
+	}
+
+	err = json.Unmarshal(data, &db.entries)
+
+	if err != nil {
+		return nil, errors.New("error reading state " + path + ": " + err.Error())
+	}
+
+	for p := range db.entries {
+		db.link(p)
+	}
+
+	return db, nil
+}
+
+// func returns an entry for the file with current info
+func NewEntry(info os.FileInfo) Entry {
+
+	return Entry{Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode(), Synced: time.Now()}
+}
+
+// func returns the stored entry for path
+func (db *DB) Get(path string) (Entry, bool) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	entry, ok := db.entries[path]
+
+	return entry, ok
+}
+
+// func stores the entry for path
+func (db *DB) Put(path string, entry Entry) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.entries[path]; !ok {
+		db.link(path)
+	}
+
+	db.entries[path] = entry
+	db.dirty = true
+}
+
+// func removes path and everything stored under it. Only the entries under path are visited
+func (db *DB) Delete(path string) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.entries[path]; !ok && db.children[path] == nil {
+		return
+	}
+
+	db.remove(path)
+	db.unlink(path)
+	db.dirty = true
+}
+
+// func adds path to the children of its parent folder, and the folders above it up to the first one already added
+func (db *DB) link(path string) {
+
+	for {
+
+		dir := filepath.Dir(path)
+
+		if dir == path {
+			return
+		}
+
+		children, ok := db.children[dir]
+
+		if !ok {
+			children = map[string]bool{}
+			db.children[dir] = children
+		}
+
+		if children[path] {
+			return
+		}
+
+		children[path] = true
+
+		path = dir
+	}
+}
+
+// func removes the entry of path and the entries under it
+func (db *DB) remove(path string) {
+
+	for child := range db.children[path] {
+		db.remove(child)
+	}
+
+	delete(db.children, path)
+	delete(db.entries, path)
+}
+
+// func removes path from the children of its parent folder, and the folders above it that are left empty
+func (db *DB) unlink(path string) {
+
+	for {
+
+		dir := filepath.Dir(path)
+
+		if dir == path {
+			return
+		}
+
+		children := db.children[dir]
+
+		delete(children, path)
+
+		if len(children) > 0 {
+			return
+		}
+
+		delete(db.children, dir)
+
+		if _, ok := db.entries[dir]; ok {
+			return
+		}
+
+		path = dir
+	}
+}
+
+// func checks if the file has the same size, modification time and mode as stored in the index
+func (db *DB) Unchanged(path string, info os.FileInfo) bool {
+
+	entry, ok := db.Get(path)
+
+	if !ok {
+		return false
+	}
+
+	return entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) && entry.Mode == info.Mode()
+}
+
+// func returns the number of files in the index and when the last of them was synchronized
+func (db *DB) Stats() (int, time.Time) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var last time.Time
+
+	for _, entry := range db.entries {
+
+		if entry.Synced.After(last) {
+			last = entry.Synced
+		}
+	}
+
+	return len(db.entries), last
+}
+
+// func writes the index to disk if it was changed since the last save
+func (db *DB) Save() error {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(db.entries)
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), ".state-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), db.path)
+
+	if err != nil {
+		return err
+	}
+
+	db.dirty = false
+
+	return nil
+}
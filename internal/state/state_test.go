@@ -0,0 +1,178 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen(t *testing.T) {
+
+	req := require.New(t)
+
+	dir := t.TempDir()
+
+	req.NoError(os.WriteFile(dir+"/broken.json", []byte("{broken"), 0644))
+
+	cases := map[string]struct {
+		path    string
+		isError bool
+		errMsg  string
+	}{
+		"no state file": {
+			path: dir + "/state.json",
+		},
+
+		"broken state file": {
+			path:    dir + "/broken.json",
+			isError: true,
+			errMsg:  "error reading state",
+		},
+
+		"wrong path": {
+			path:    dir,
+			isError: true,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			db, err := Open(cs.path)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+				req.NotNil(db)
+			}
+		})
+	}
+
+}
+
+func TestSave(t *testing.T) {
+
+	req := require.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	db, err := Open(path)
+	req.NoError(err)
+
+	mtime := time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC)
+	db.Put("/master/file1", Entry{Size: 10, ModTime: mtime, Mode: 0644})
+
+	req.NoError(db.Save())
+
+	db, err = Open(path)
+	req.NoError(err)
+
+	entry, ok := db.Get("/master/file1")
+	req.True(ok)
+	req.Equal(int64(10), entry.Size)
+	req.True(mtime.Equal(entry.ModTime))
+	req.Equal(os.FileMode(0644), entry.Mode)
+
+	files, err := os.ReadDir(dir)
+	req.NoError(err)
+	req.Len(files, 1)
+
+}
+
+func TestUnchanged(t *testing.T) {
+
+	req := require.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file1")
+
+	req.NoError(os.WriteFile(path, []byte("test"), 0644))
+
+	info, err := os.Stat(path)
+	req.NoError(err)
+
+	db, err := Open(filepath.Join(dir, "state.json"))
+	req.NoError(err)
+
+	req.False(db.Unchanged(path, info))
+
+	db.Put(path, NewEntry(info))
+	req.True(db.Unchanged(path, info))
+
+	req.NoError(os.WriteFile(path, []byte("changed"), 0644))
+
+	info, err = os.Stat(path)
+	req.NoError(err)
+	req.False(db.Unchanged(path, info))
+
+}
+
+func TestDelete(t *testing.T) {
+
+	req := require.New(t)
+
+	db, err := Open(filepath.Join(t.TempDir(), "state.json"))
+	req.NoError(err)
+
+	db.Put("/slave/dir/file1", Entry{})
+	db.Put("/slave/dir/sub/file2", Entry{})
+	db.Put("/slave/dir2", Entry{})
+
+	db.Delete("/slave/dir")
+
+	_, ok := db.Get("/slave/dir/file1")
+	req.False(ok)
+	_, ok = db.Get("/slave/dir/sub/file2")
+	req.False(ok)
+	_, ok = db.Get("/slave/dir2")
+	req.True(ok)
+
+	// entries stored again after the delete are found under their folders
+	db.Put("/slave/dir/file3", Entry{})
+	db.Put("/master/file1", Entry{})
+	req.NoError(db.Save())
+
+	db, err = Open(db.path)
+	req.NoError(err)
+
+	db.Delete("/slave/missing")
+	req.False(db.dirty)
+
+	db.Delete("/slave")
+
+	count, _ := db.Stats()
+	req.Equal(1, count)
+
+	// folders of deleted entries are dropped from the index
+	db.Delete("/master/file1")
+	req.Empty(db.children)
+
+}
+
+func TestStats(t *testing.T) {
+
+	req := require.New(t)
+
+	db, err := Open(t.TempDir() + "/state.json")
+	req.NoError(err)
+
+	count, last := db.Stats()
+	req.Zero(count)
+	req.True(last.IsZero())
+
+	now := time.Now()
+
+	db.Put("/a", Entry{Size: 1, Synced: now.Add(-time.Hour)})
+	db.Put("/b", Entry{Size: 2, Synced: now})
+
+	count, last = db.Stats()
+	req.Equal(2, count)
+	req.True(now.Equal(last))
+
+}
@@ -0,0 +1,171 @@
+package synch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"synchfolder/internal/logger"
+	"syscall"
+	"unicode/utf8"
+)
+
+// prefix of temporary files that are written to the slave folder before they are renamed
+const TempPrefix string = ".synch-tmp-"
+
+// temporary names keep at most this many bytes of the file name, so they fit the 255 bytes limit of file names
+const tempNameLen = 64
+
+// temporary names end with a dash and this many random hex digits
+const tempSuffixLen = 16
+
+// func returns a new hidden temporary name next to path: the prefix, the name and a random suffix
+func tempName(path string) string {
+
+	dir, name := filepath.Split(path)
+
+	if len(name) > tempNameLen {
+
+		cut := tempNameLen
+
+		// a multibyte character isn't split
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+
+		name = name[:cut]
+	}
+
+	return filepath.Join(dir, TempPrefix+name+"-"+fmt.Sprintf("%0*x", tempSuffixLen, rand.Uint64()))
+}
+
+// func creates a new hidden temporary file of fsys next to path and returns it with its name
+func createTemp(fsys FS, path string) (File, string, error) {
+
+	for i := 0; i < 100; i++ {
+
+		name := tempName(path)
+
+		file, err := fsys.Create(name, 0666)
+
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+
+		return file, name, err
+	}
+
+	return nil, "", errors.New("can't create temporary file for " + path)
+}
+
+// func flushes the folder entries to disk so that a renamed file survives a crash.
+// Only folders of the file system of the operating system are flushed
+func syncFolder(fsys FS, path string) error {
+
+	if !native(fsys) {
+		return nil
+	}
+
+	folder, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer folder.Close()
+
+	err = folder.Sync()
+
+	// some file systems don't support sync of folders
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP) {
+		return nil
+	}
+
+	return err
+}
+
+// func checks if the file is a temporary file of a copy. The name must have the exact shape of tempName,
+// so other files that start with the prefix are synchronized as usual
+func isTemp(name string) bool {
+
+	suffix := len(name) - tempSuffixLen
+
+	if !strings.HasPrefix(name, TempPrefix) || suffix <= len(TempPrefix) || name[suffix-1] != '-' {
+		return false
+	}
+
+	for _, c := range name[suffix:] {
+
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// func removes temporary files left in the slave folder by copies that were interrupted
+func CleanTempFiles(slavePath string) error {
+
+	return cleanTempFiles("", slavePath, env{})
+}
+
+// func removes temporary files of the slave folder of the job. A file that the master folder has too
+// is a copy, not a temporary file, it is kept. masterPath may be empty, then nothing is kept.
+// A folder that can't be read stops the cleaning
+func cleanTempFiles(masterPath, slavePath string, e env) error {
+
+	entries, err := e.files().ReadDir(slavePath)
+
+	if err != nil {
+
+		e.send(logger.Error("CleanTempFiles", "folder can't be read").WithPath(slavePath).WithErr(err))
+
+		return err
+	}
+
+	for _, entry := range entries {
+
+		path := filepath.Join(slavePath, entry.Name())
+
+		source := ""
+
+		if masterPath != "" {
+			source = filepath.Join(masterPath, entry.Name())
+		}
+
+		if entry.IsDir() {
+
+			if err = cleanTempFiles(source, path, e); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !isTemp(entry.Name()) {
+			continue
+		}
+
+		if source != "" {
+
+			if _, err = e.files().Lstat(source); err == nil {
+				continue
+			}
+		}
+
+		if err = e.files().Remove(path); err != nil {
+
+			e.send(logger.Error("CleanTempFiles", "temporary file can't be deleted").WithPath(path).WithErr(err))
+
+			continue
+		}
+
+		e.send(logger.Info("CleanTempFiles", "temporary file deleted").WithPath(path))
+	}
+
+	return nil
+}
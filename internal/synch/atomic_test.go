@@ -0,0 +1,164 @@
+package synch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFileAtomic(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("new content"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/file1", []byte("old"), 0644))
+
+	long := strings.Repeat("ä", 127) + "x"
+	req.NoError(os.WriteFile(masterPath+"/"+long, []byte("long"), 0644))
+
+	cases := map[string]struct {
+		inPath  string
+		outPath string
+		isError bool
+		content string
+	}{
+		"replace existing file": {
+			inPath:  masterPath + "/file1",
+			outPath: slavePath + "/file1",
+			content: "new content",
+		},
+
+		"no slave folder": {
+			inPath:  masterPath + "/file1",
+			outPath: slavePath + "/missing/file1",
+			isError: true,
+		},
+
+		// the temporary name is shorter than the longest name
+		"long name": {
+			inPath:  masterPath + "/" + long,
+			outPath: slavePath + "/" + long,
+			content: "long",
+		},
+
+		"no master file": {
+			inPath:  masterPath + "/file2",
+			outPath: slavePath + "/file2",
+			isError: true,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := copyFile(cs.inPath, cs.outPath)
+
+			if cs.isError {
+				req.Error(err)
+			} else {
+				req.NoError(err)
+
+				data, err := os.ReadFile(cs.outPath)
+				req.NoError(err)
+				req.Equal(cs.content, string(data))
+			}
+
+			// no temporary files are left
+			folder, err := os.ReadDir(slavePath)
+			req.NoError(err)
+
+			for _, entry := range folder {
+				req.False(isTemp(entry.Name()), entry.Name())
+			}
+		})
+	}
+
+}
+
+func TestCleanTempFiles(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	temp1 := tempName(slavePath + "/file1")
+	temp2 := tempName(slavePath + "/dir/file2")
+	temp3 := tempName(slavePath + "/dir/file3")
+
+	// files named like temporary files but not of their shape, and a copy of a source file of the shape
+	notes := slavePath + "/" + TempPrefix + "notes"
+	short := slavePath + "/" + TempPrefix + "file1-abc"
+	copied := masterPath + "/dir/" + filepath.Base(temp3)
+
+	req.NoError(os.MkdirAll(slavePath+"/dir", 0755))
+	req.NoError(os.MkdirAll(masterPath+"/dir", 0755))
+
+	for _, path := range []string{slavePath + "/file1", temp1, temp2, temp3, notes, short, copied} {
+		req.NoError(os.WriteFile(path, []byte("te"), 0644))
+	}
+
+	req.NoError(cleanTempFiles(masterPath, slavePath, env{}))
+
+	for _, path := range []string{slavePath + "/file1", temp3, notes, short} {
+		_, err := os.Stat(path)
+		req.NoError(err, path)
+	}
+
+	for _, path := range []string{temp1, temp2} {
+		_, err := os.Stat(path)
+		req.ErrorIs(err, os.ErrNotExist, path)
+	}
+
+	// without the source folder every temporary file is removed
+	req.NoError(CleanTempFiles(slavePath))
+
+	_, err := os.Stat(temp3)
+	req.ErrorIs(err, os.ErrNotExist)
+
+	req.Error(CleanTempFiles(slavePath + "/missing"))
+
+}
+
+func TestTempName(t *testing.T) {
+
+	req := require.New(t)
+
+	cases := map[string]struct {
+		name   string
+		prefix string
+	}{
+		"short name": {
+			name:   "file1",
+			prefix: TempPrefix + "file1-",
+		},
+
+		"long name": {
+			name:   strings.Repeat("a", 255),
+			prefix: TempPrefix + strings.Repeat("a", tempNameLen) + "-",
+		},
+
+		"multibyte character at the cut": {
+			name:   "a" + strings.Repeat("ä", 127),
+			prefix: TempPrefix + "a" + strings.Repeat("ä", 31) + "-",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			tmp := tempName("/slave/dir/" + cs.name)
+
+			req.True(strings.HasPrefix(tmp, "/slave/dir/"+cs.prefix), tmp)
+			req.LessOrEqual(len(tmp)-len("/slave/dir/"), len(TempPrefix)+tempNameLen+1+tempSuffixLen)
+			req.True(isTemp(filepath.Base(tmp)), tmp)
+		})
+	}
+
+}
@@ -0,0 +1,175 @@
+package synch
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"synchfolder/internal/logger"
+)
+
+// Breaker stops a check that looks like the source folder is lost: too many deletions,
+// another device mounted at the source path or a missing sentinel file
+type Breaker struct {
+	MaxCount   int     // the maximum number of entries deleted in one check, 0 means no limit
+	MaxPercent float64 // the maximum percent of the synch folder deleted in one full check, 0 means no limit
+	Sentinel   string  // the path of a file relative to the source folder that must exist
+
+	mu        sync.Mutex
+	device    uint64
+	hasDevice bool
+	override  bool
+}
+
+// BreakerError is returned when a check is aborted by the breaker
+type BreakerError struct {
+	Reason string
+}
+
+func (e *BreakerError) Error() string {
+
+	return "check is aborted: " + e.Reason
+}
+
+var CircuitBreaker = &Breaker{}
+
+// func remembers the device of the source folder. A check is aborted if the source folder is on another device later
+func (b *Breaker) RecordDevice(masterPath string) error {
+
+	info, err := os.Stat(masterPath)
+
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.device, b.hasDevice = device(info)
+
+	return nil
+}
+
+// func lets the next check go on even if the breaker would abort it. Only the next check is overridden,
+// whether it needs it or not
+func (b *Breaker) Override() {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.override = true
+}
+
+// func checks the plan of the job before it is executed. full is set if the whole tree is planned,
+// only then the percent of deletions is checked. A nil breaker lets everything go on
+func (b *Breaker) check(plan *Plan, full bool, e env) error {
+
+	if b == nil {
+		return nil
+	}
+
+	reason := b.reason(e.files(), plan, full)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// the override is only for the first check, a later one that looks wrong is aborted again
+	override := b.override
+	b.override = false
+
+	if reason == "" {
+		return nil
+	}
+
+	if override {
+
+		// the new device is the right one from now on
+		if info, err := e.files().Stat(plan.Master); err == nil && b.hasDevice {
+			b.device, _ = device(info)
+		}
+
+		e.send(logger.Info("breaker", "breaker is overridden: "+reason).WithPath(plan.Master))
+
+		return nil
+	}
+
+	e.send(logger.Critical("breaker", "check is aborted: "+reason+". Run with the force command to proceed").WithPath(plan.Master))
+
+	return &BreakerError{Reason: reason}
+}
+
+// func returns why the plan of folders of fsys must not be executed or "" if it may be
+func (b *Breaker) reason(fsys FS, plan *Plan, full bool) string {
+
+	if b.Sentinel != "" {
+
+		if _, err := fsys.Lstat(plan.Master + "/" + b.Sentinel); err != nil {
+			return "sentinel file " + b.Sentinel + " is not found in " + plan.Master
+		}
+	}
+
+	b.mu.Lock()
+	hasDevice, recorded := b.hasDevice, b.device
+	b.mu.Unlock()
+
+	if hasDevice {
+
+		info, err := fsys.Stat(plan.Master)
+
+		if err != nil {
+			return err.Error()
+		}
+
+		if dev, _ := device(info); dev != recorded {
+			return plan.Master + " is on another device than at start"
+		}
+	}
+
+	if b.MaxCount == 0 && (b.MaxPercent == 0 || !full) {
+		return ""
+	}
+
+	deleted, total := plan.deletions()
+
+	if b.MaxCount > 0 && deleted > b.MaxCount {
+		return fmt.Sprintf("%d entries would be deleted, the limit is %d", deleted, b.MaxCount)
+	}
+
+	if b.MaxPercent > 0 && full && total > 0 && float64(deleted)*100/float64(total) > b.MaxPercent {
+		return fmt.Sprintf("%d of %d entries would be deleted, the limit is %g%%", deleted, total, b.MaxPercent)
+	}
+
+	return ""
+}
+
+// func returns the number of entries of the synch folder the plan deletes, including the content
+// of deleted folders, and the number of all entries of the synch folder
+func (p *Plan) deletions() (int, int) {
+
+	if p.replica == nil {
+		return 0, 0
+	}
+
+	deleted := map[string]bool{}
+
+	for _, op := range p.Ops {
+
+		if isDelete(op) {
+			deleted[op.Path] = true
+		}
+	}
+
+	count := 0
+
+	for path := range p.replica.Entries {
+
+		for dir := path; dir != ""; dir = parent(dir) {
+
+			if deleted[dir] {
+				count++
+				break
+			}
+		}
+	}
+
+	return count, len(p.replica.Entries) - 1
+}
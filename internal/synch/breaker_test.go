@@ -0,0 +1,186 @@
+package synch
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { CircuitBreaker = &Breaker{} }()
+
+	cases := map[string]struct {
+		breaker   *Breaker
+		folders   []string
+		recursive bool
+		prepare   func(b *Breaker, masterPath string)
+		reason    string
+	}{
+		"no limits": {
+			breaker:   &Breaker{},
+			recursive: true,
+		},
+
+		"count is reached": {
+			breaker:   &Breaker{MaxCount: 5},
+			recursive: true,
+			reason:    "6 entries would be deleted, the limit is 5",
+		},
+
+		"count is not reached": {
+			breaker:   &Breaker{MaxCount: 6},
+			recursive: true,
+		},
+
+		"percent is reached": {
+			breaker:   &Breaker{MaxPercent: 50},
+			recursive: true,
+			reason:    "6 of 9 entries would be deleted, the limit is 50%",
+		},
+
+		"percent is not checked for folders": {
+			breaker: &Breaker{MaxPercent: 50},
+			folders: []string{"", "dir"},
+		},
+
+		"sentinel is missing": {
+			breaker:   &Breaker{Sentinel: ".mounted"},
+			recursive: true,
+			prepare: func(b *Breaker, masterPath string) {
+				req.NoError(os.Remove(masterPath + "/.mounted"))
+			},
+			reason: "sentinel file .mounted is not found in ",
+		},
+
+		"device is changed": {
+			breaker:   &Breaker{},
+			recursive: true,
+			prepare: func(b *Breaker, masterPath string) {
+				req.NoError(b.RecordDevice(masterPath))
+				b.device++
+			},
+			reason: "is on another device than at start",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			masterPath := t.TempDir()
+			slavePath := t.TempDir()
+
+			req.NoError(os.WriteFile(masterPath+"/.mounted", []byte{}, 0644))
+			req.NoError(os.WriteFile(slavePath+"/.mounted", []byte{}, 0644))
+			req.NoError(os.MkdirAll(slavePath+"/dir", 0755))
+			req.NoError(os.MkdirAll(masterPath+"/dir", 0755))
+			req.NoError(os.WriteFile(slavePath+"/dir/keep", []byte("test"), 0644))
+			req.NoError(os.WriteFile(masterPath+"/dir/keep", []byte("test"), 0644))
+
+			// the source folder looks empty
+			req.NoError(os.MkdirAll(slavePath+"/gone", 0755))
+
+			for i := 0; i < 3; i++ {
+				req.NoError(os.WriteFile(slavePath+"/gone/file"+strconv.Itoa(i), []byte("test"), 0644))
+			}
+
+			req.NoError(os.WriteFile(slavePath+"/dir/file1", []byte("test"), 0644))
+			req.NoError(os.WriteFile(slavePath+"/file2", []byte("test"), 0644))
+
+			CircuitBreaker = cs.breaker
+
+			if cs.prepare != nil {
+				cs.prepare(cs.breaker, masterPath)
+			}
+
+			folders := cs.folders
+
+			if folders == nil {
+				folders = []string{""}
+			}
+
+			_, _, err := globalJob(masterPath, slavePath).synchFolders(context.Background(), folders, cs.recursive, nil)
+
+			if cs.reason == "" {
+				req.NoError(err)
+
+				_, err = os.Stat(slavePath + "/dir/file1")
+				req.ErrorIs(err, os.ErrNotExist)
+				return
+			}
+
+			var breakerErr *BreakerError
+
+			req.ErrorAs(err, &breakerErr)
+			req.Contains(breakerErr.Reason, cs.reason)
+
+			select {
+			case <-CriticalChan:
+			default:
+				req.Fail("critical error is not signaled")
+			}
+
+			// nothing is changed
+			_, err = os.Stat(slavePath + "/dir/file1")
+			req.NoError(err)
+
+			// the next check goes on only with the override
+			CircuitBreaker.Override()
+
+			_, _, err = globalJob(masterPath, slavePath).synchFolders(context.Background(), folders, cs.recursive, nil)
+			req.NoError(err)
+
+			_, err = os.Stat(slavePath + "/dir/file1")
+			req.ErrorIs(err, os.ErrNotExist)
+
+			req.False(CircuitBreaker.override)
+		})
+	}
+
+}
+
+func TestBreakerOverrideFirstCheck(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { CircuitBreaker = &Breaker{} }()
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	for i := 0; i < 3; i++ {
+		req.NoError(os.WriteFile(masterPath+"/file"+strconv.Itoa(i), []byte("test"), 0644))
+	}
+
+	CircuitBreaker = &Breaker{MaxCount: 2}
+
+	// --force is given, the first check is clean
+	CircuitBreaker.Override()
+
+	_, _, err := globalJob(masterPath, slavePath).synchFolders(context.Background(), []string{""}, true, nil)
+	req.NoError(err)
+	req.False(CircuitBreaker.override)
+
+	// the source is emptied days later, the override doesn't let the deletions go on
+	for i := 0; i < 3; i++ {
+		req.NoError(os.Remove(masterPath + "/file" + strconv.Itoa(i)))
+	}
+
+	_, _, err = globalJob(masterPath, slavePath).synchFolders(context.Background(), []string{""}, true, nil)
+
+	var breakerErr *BreakerError
+
+	req.ErrorAs(err, &breakerErr)
+	req.Equal("3 entries would be deleted, the limit is 2", breakerErr.Reason)
+
+	<-CriticalChan
+
+	_, err = os.Stat(slavePath + "/file0")
+	req.NoError(err)
+
+}
@@ -0,0 +1,134 @@
+package synch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	CompareSize    string = "SIZE"
+	CompareModTime string = "MTIME"
+	CompareSHA256  string = "SHA256"
+	CompareFNV     string = "FNV"
+)
+
+// modification times that differ less than this are the same: FAT keeps them with 2 seconds precision
+const modTimeTolerance = 2 * time.Second
+
+// Comparator reports whether the replica file is up to date with the master file
+type Comparator func(masterFile, slaveFile string, msInfo, slInfo os.FileInfo) (bool, error)
+
+var CompareMode string
+
+// comparators of every compare mode for files of a file system
+var comparators map[string]func(fsys FS) Comparator
+
+func init() {
+
+	CompareMode = CompareSHA256
+
+	comparators = map[string]func(fsys FS) Comparator{
+		CompareSize:    func(FS) Comparator { return compareSize },
+		CompareModTime: func(FS) Comparator { return compareModTime },
+		CompareSHA256:  func(fsys FS) Comparator { return compareHash(fsys, sha256.New) },
+		CompareFNV:     func(fsys FS) Comparator { return compareHash(fsys, func() hash.Hash { return fnv.New64a() }) },
+	}
+}
+
+// func sets the strategy used to decide whether a replica file has to be updated
+func SetCompareMode(mode string) error {
+
+	mode = strings.ToUpper(mode)
+
+	if _, ok := comparators[mode]; ok {
+		CompareMode = mode
+
+	} else {
+		return errors.New("compare mode is not set in config. Default compare mode SHA256")
+	}
+
+	return nil
+}
+
+// func compares two files with the strategy selected by CompareMode
+func filesEqual(masterFile, slaveFile string, msInfo, slInfo os.FileInfo) (bool, error) {
+
+	compare, ok := comparators[CompareMode]
+
+	if !ok {
+		return false, errors.New("unknown compare mode " + CompareMode)
+	}
+
+	return compare(OS)(masterFile, slaveFile, msInfo, slInfo)
+}
+
+// files are equal if they have the same size
+func compareSize(masterFile, slaveFile string, msInfo, slInfo os.FileInfo) (bool, error) {
+
+	return msInfo.Size() == slInfo.Size(), nil
+}
+
+// files are equal if they have the same size and modification time. Copies get the time of the master,
+// so a replica changed after the copy is found too
+func compareModTime(masterFile, slaveFile string, msInfo, slInfo os.FileInfo) (bool, error) {
+
+	if msInfo.Size() != slInfo.Size() {
+		return false, nil
+	}
+
+	diff := msInfo.ModTime().Sub(slInfo.ModTime())
+
+	return diff > -modTimeTolerance && diff < modTimeTolerance, nil
+}
+
+// files of fsys are equal if they have the same size and the same content hash
+func compareHash(fsys FS, newHash func() hash.Hash) Comparator {
+
+	return func(masterFile, slaveFile string, msInfo, slInfo os.FileInfo) (bool, error) {
+
+		if msInfo.Size() != slInfo.Size() {
+			return false, nil
+		}
+
+		msSum, err := fileHash(fsys, masterFile, newHash())
+
+		if err != nil {
+			return false, err
+		}
+
+		slSum, err := fileHash(fsys, slaveFile, newHash())
+
+		if err != nil {
+			return false, err
+		}
+
+		return bytes.Equal(msSum, slSum), nil
+	}
+}
+
+// func returns the hash sum of the content of the file of fsys
+func fileHash(fsys FS, path string, h hash.Hash) ([]byte, error) {
+
+	file, err := fsys.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	_, err = io.Copy(h, file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
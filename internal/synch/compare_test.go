@@ -0,0 +1,210 @@
+package synch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCompareMode(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { CompareMode = CompareSHA256 }()
+
+	cases := map[string]struct {
+		mode    string
+		isError bool
+		errMsg  string
+	}{
+		"success SIZE": {
+			mode: "SIZE",
+		},
+
+		"success mtime": {
+			mode: "mtime",
+		},
+
+		"success SHA256": {
+			mode: "SHA256",
+		},
+
+		"success FNV": {
+			mode: "fnv",
+		},
+
+		"wrong compare mode": {
+			mode:    "MD5",
+			isError: true,
+			errMsg:  "compare mode is not set in config. Default compare mode SHA256",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := SetCompareMode(cs.mode)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+			}
+		})
+	}
+
+}
+
+func TestFilesEqual(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { CompareMode = CompareSHA256 }()
+
+	dir := t.TempDir()
+
+	master := filepath.Join(dir, "master")
+	sameSize := filepath.Join(dir, "samesize")
+	same := filepath.Join(dir, "same")
+	newer := filepath.Join(dir, "newer")
+	nearly := filepath.Join(dir, "nearly")
+	shorter := filepath.Join(dir, "shorter")
+
+	req.NoError(os.WriteFile(master, []byte("flag=true"), 0644))
+	req.NoError(os.WriteFile(sameSize, []byte("flag=nope"), 0644))
+	req.NoError(os.WriteFile(same, []byte("flag=true"), 0644))
+	req.NoError(os.WriteFile(newer, []byte("flag=true"), 0644))
+	req.NoError(os.WriteFile(nearly, []byte("flag=true"), 0644))
+	req.NoError(os.WriteFile(shorter, []byte("flag"), 0644))
+
+	now := time.Now()
+	old := now.Add(-time.Hour)
+
+	req.NoError(os.Chtimes(master, now, now))
+	req.NoError(os.Chtimes(same, now, now))
+	req.NoError(os.Chtimes(sameSize, old, old))
+	req.NoError(os.Chtimes(newer, now.Add(time.Hour), now.Add(time.Hour)))
+	req.NoError(os.Chtimes(nearly, now.Add(-time.Second), now.Add(-time.Second)))
+
+	cases := map[string]struct {
+		mode    string
+		slave   string
+		isEqual bool
+	}{
+		"SIZE same size different content": {
+			mode:    CompareSize,
+			slave:   sameSize,
+			isEqual: true,
+		},
+
+		"SIZE different size": {
+			mode:  CompareSize,
+			slave: shorter,
+		},
+
+		"MTIME replica is older": {
+			mode:  CompareModTime,
+			slave: sameSize,
+		},
+
+		// the replica was changed after the copy
+		"MTIME replica is newer": {
+			mode:  CompareModTime,
+			slave: newer,
+		},
+
+		"MTIME same time": {
+			mode:    CompareModTime,
+			slave:   same,
+			isEqual: true,
+		},
+
+		"MTIME time within tolerance": {
+			mode:    CompareModTime,
+			slave:   nearly,
+			isEqual: true,
+		},
+
+		"SHA256 same size different content": {
+			mode:  CompareSHA256,
+			slave: sameSize,
+		},
+
+		"SHA256 same content": {
+			mode:    CompareSHA256,
+			slave:   same,
+			isEqual: true,
+		},
+
+		"FNV same size different content": {
+			mode:  CompareFNV,
+			slave: sameSize,
+		},
+
+		"FNV same content": {
+			mode:    CompareFNV,
+			slave:   same,
+			isEqual: true,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			CompareMode = cs.mode
+
+			msInfo, err := os.Stat(master)
+			req.NoError(err)
+			slInfo, err := os.Stat(cs.slave)
+			req.NoError(err)
+
+			equal, err := filesEqual(master, cs.slave, msInfo, slInfo)
+
+			req.NoError(err)
+			req.Equal(cs.isEqual, equal)
+		})
+	}
+
+}
+
+func TestCompareModTimeCopy(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	old := time.Now().Add(-time.Hour)
+
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("test"), 0644))
+	req.NoError(os.Chtimes(masterPath+"/file1", old, old))
+
+	s := NewSyncer(masterPath, slavePath, Options{Compare: CompareModTime})
+
+	result, err := s.Sync(context.Background())
+	req.NoError(err)
+	req.Equal(1, result.Summary.Copied)
+
+	// the copy gets the time of the source without preserve, so it is equal on the next check
+	info, err := os.Stat(slavePath + "/file1")
+	req.NoError(err)
+	req.True(old.Equal(info.ModTime()))
+
+	plan, err := s.DryRun(context.Background())
+	req.NoError(err)
+	req.Empty(plan.Ops)
+
+	// a replica changed after the copy is copied again
+	req.NoError(os.WriteFile(slavePath+"/file1", []byte("edit"), 0644))
+
+	plan, err = s.DryRun(context.Background())
+	req.NoError(err)
+	req.Len(plan.Ops, 1)
+	req.Equal(ReasonModTime, plan.Ops[0].Reason)
+
+}
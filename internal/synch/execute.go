@@ -0,0 +1,640 @@
+package synch
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"synchfolder/internal/logger"
+	"synchfolder/internal/state"
+	"synchfolder/internal/trash"
+	"time"
+)
+
+// Result is the outcome of an executed operation
+type Result struct {
+	Op  Operation
+	Err error
+}
+
+// number of copies of a job executed at the same time
+var Workers int
+
+// number of metadata operations of a job executed at the same time: folders, links, attributes and deletions
+var MetaWorkers int
+
+// if it is set, it is called after every executed operation with the number of done and all operations
+var Progress func(done, total int, result Result)
+
+// how long copies in progress may go on after a check is stopped, then they are rolled back
+var DrainTimeout time.Duration
+
+func init() {
+
+	Workers = 8
+	MetaWorkers = 16
+	DrainTimeout = 30 * time.Second
+}
+
+// executor applies plans to the synch folder
+type executor struct {
+	workers      int // copies at the same time
+	metaWorkers  int // metadata operations at the same time
+	preserve     Preserve
+	state        *state.DB
+	progress     func(done, total int, result Result)
+	maxDeletions int
+	trash        *trash.Trash
+	pool         *Pool
+	drain        time.Duration
+	env
+
+	mu      sync.Mutex
+	done    int
+	limit   *deleteLimit
+	limited sync.Once
+	stamp   time.Time // name of the trash folder of this execution
+	trashed bool
+	abort   chan struct{} // closed when copies in progress must be rolled back
+}
+
+// func returns an executor with the options of the job
+func newExecutor(j *Job) *executor {
+
+	workers, meta := j.limits()
+
+	preserve := j.Preserve
+
+	// copies are compared by their modification time, so they must get the one of the source
+	if j.Comparator == nil && j.Compare == CompareModTime {
+		preserve.Times = true
+	}
+
+	return &executor{
+		workers:      workers,
+		metaWorkers:  meta,
+		preserve:     preserve,
+		state:        j.State,
+		progress:     j.Progress,
+		maxDeletions: j.MaxDeletions,
+		trash:        j.Trash,
+		pool:         j.Pool,
+		drain:        j.Drain,
+		env:          j.environment(),
+	}
+}
+
+// func executes the operations of the plan and returns the result of every operation in the plan order.
+// Operations of one stage run at the same time, a stage starts when the previous one is finished.
+// When ctx is done no more operations are started, they get the error of ctx. Copies in progress
+// may go on for the drain time, then they are rolled back
+func (e *executor) execute(ctx context.Context, plan *Plan) []Result {
+
+	results := make([]Result, len(plan.Ops))
+
+	e.done = 0
+	e.limit = newDeleteLimit(e.maxDeletions)
+	e.limited = sync.Once{}
+	e.stamp = time.Now()
+	e.trashed = false
+	e.abort = make(chan struct{})
+
+	finished := make(chan struct{})
+
+	defer close(finished)
+
+	go e.watchStop(ctx, finished)
+
+	for start := 0; start < len(plan.Ops); {
+
+		stage := opStage(plan.Ops[start])
+		end := start + 1
+
+		for end < len(plan.Ops) && opStage(plan.Ops[end]) == stage {
+			end++
+		}
+
+		data, meta := e.workers, e.metaWorkers
+
+		// folders are created parents first and get their attributes deepest first
+		if stage == stageFolders || stage == stageFolderMeta {
+			meta = 1
+		}
+
+		e.run(ctx, plan, start, end, data, meta, results)
+
+		start = end
+	}
+
+	if skipped := canceled(results); skipped > 0 {
+		e.send(logger.Info("execute", "check is stopped, "+strconv.Itoa(skipped)+" operations are not done").WithPath(plan.Slave))
+	}
+
+	for _, path := range plan.Synced {
+		e.setSynced(plan.Master+"/"+path, plan.Slave+"/"+path)
+	}
+
+	if e.trashed {
+		cleanTrash(e.trash, e.env)
+	}
+
+	return results
+}
+
+// func closes abort when the drain time is over after ctx is done, unless the execution is finished before
+func (e *executor) watchStop(ctx context.Context, finished chan struct{}) {
+
+	select {
+	case <-ctx.Done():
+	case <-finished:
+		return
+	}
+
+	timer := time.NewTimer(e.drain)
+
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		close(e.abort)
+	case <-finished:
+	}
+}
+
+// func counts operations that are not done because the execution is stopped
+func canceled(results []Result) int {
+
+	count := 0
+
+	for _, result := range results {
+
+		if result.Err == context.Canceled || result.Err == context.DeadlineExceeded {
+			count++
+		}
+	}
+
+	return count
+}
+
+// func runs operations from start to end of the plan. Copies and metadata operations have their own workers,
+// so copies of big files don't hold back cheap operations
+func (e *executor) run(ctx context.Context, plan *Plan, start, end, data, meta int, results []Result) {
+
+	var wg sync.WaitGroup
+
+	for _, class := range []bool{true, false} {
+
+		workers := meta
+
+		if class {
+			workers = data
+		}
+
+		wg.Add(1)
+
+		go func(class bool, workers int) {
+
+			defer wg.Done()
+
+			e.runClass(ctx, plan, start, end, class, workers, results)
+
+		}(class, workers)
+	}
+
+	wg.Wait()
+}
+
+// func runs copies (data is set) or metadata operations from start to end of the plan with the number of workers.
+// Workers get operations one by one when they are free, so the plan is not read ahead of them.
+// Operations that are not started when ctx is done get the error of ctx
+func (e *executor) runClass(ctx context.Context, plan *Plan, start, end int, data bool, workers int, results []Result) {
+
+	indexes := []int{}
+
+	for index := start; index < end; index++ {
+
+		if dataOp(plan.Ops[index]) == data {
+			indexes = append(indexes, index)
+		}
+	}
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers && i < len(indexes); i++ {
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			for index := range jobs {
+
+				op := plan.Ops[index]
+
+				// the pool is shared by all jobs
+				e.pool.acquire(op)
+
+				if err := ctx.Err(); err != nil {
+					results[index] = Result{Op: op, Err: err}
+				} else {
+					results[index] = Result{Op: op, Err: e.apply(plan, op)}
+				}
+
+				e.pool.release(op)
+
+				e.report(len(plan.Ops), results[index])
+			}
+		}()
+	}
+
+	for _, index := range indexes {
+
+		if ctx.Err() != nil {
+			results[index] = Result{Op: plan.Ops[index], Err: ctx.Err()}
+			continue
+		}
+
+		select {
+
+		case jobs <- index:
+
+		case <-ctx.Done():
+			results[index] = Result{Op: plan.Ops[index], Err: ctx.Err()}
+		}
+	}
+
+	close(jobs)
+
+	wg.Wait()
+}
+
+// func checks if the operation copies file data, other operations change only metadata
+func dataOp(op Operation) bool {
+
+	return op.Type == OpCopyFile
+}
+
+// func applies a single operation to the synch folder
+func (e *executor) apply(plan *Plan, op Operation) error {
+
+	masterPath := plan.Master + "/" + op.Path
+	slavePath := plan.Slave + "/" + op.Path
+
+	if op.Path == "" {
+		masterPath = plan.Master
+		slavePath = plan.Slave
+	}
+
+	var err error
+
+	// the message of a done operation
+	var message string
+
+	start := time.Now()
+
+	switch op.Type {
+
+	case OpDeleteFile:
+
+		if err = e.limit.take(); err == nil {
+			err = e.delete(slavePath, op.Path, func(path string) error { return deleteFile(e.files(), path) })
+		}
+
+		if err == nil {
+			e.unsetSynced(masterPath, slavePath)
+
+			if e.trash == nil {
+				message = "file deleted"
+			}
+		}
+
+	case OpDeleteDir:
+
+		if e.trash == nil {
+			err = removeTree(e.files(), slavePath, e.limit)
+
+		} else {
+			err = e.trashTree(slavePath, op.Path)
+		}
+
+		if err == nil {
+			e.unsetSynced(masterPath, slavePath)
+
+			if e.trash == nil {
+				message = "folder deleted"
+			}
+		}
+
+	case OpMkdir:
+
+		err = makeFolder(e.files(), slavePath, op.Info.Mode().Perm())
+
+		if err == nil {
+			message = "folder created"
+		}
+
+	case OpCopyFile:
+
+		// the old copy is kept in the trash before it is overwritten
+		if op.Reason != ReasonMissing {
+			err = e.keep(slavePath, op.Path)
+		}
+
+		if err == nil {
+			err = copyFileAbort(e.files(), masterPath, slavePath, e.preserve, e.abort)
+		}
+
+		if err == nil {
+			e.setSynced(masterPath, slavePath)
+
+			message = "file copied from " + masterPath
+		}
+
+	case OpUpdateMeta:
+
+		err = e.preserve.apply(e.files(), masterPath, slavePath, op.Info)
+
+		if err == nil {
+			message = "attributes updated"
+		}
+
+	case OpSymlink:
+
+		err = replaceEntry(e.files(), slavePath, func(tmp string) error { return e.files().Symlink(op.Target, tmp) })
+
+		if err == nil {
+			message = "symlink to " + op.Target + " created"
+		}
+
+	case OpSpecial:
+
+		// special files are made by the system
+		if native(e.files()) {
+			err = replaceEntry(e.files(), slavePath, func(tmp string) error { return makeSpecial(tmp, op.Info) })
+		} else {
+			err = errors.New("special files are not supported by the file system")
+		}
+
+		if err == nil {
+			message = "special file created"
+		}
+
+	case OpHardLink:
+
+		first := plan.Slave + "/" + op.Target
+
+		err = replaceEntry(e.files(), slavePath, func(tmp string) error { return e.files().Link(first, tmp) })
+
+		if err == nil {
+			message = "hard link to " + first + " created"
+		}
+
+	default:
+
+		err = errors.New("unknown operation " + op.Type)
+	}
+
+	if err == ErrDeleteLimit {
+		e.limitReached()
+		return err
+	}
+
+	if purgeErr, ok := err.(*PurgeError); ok && purgeErr.limited() {
+		e.limitReached()
+	}
+
+	if err != nil {
+		e.send(logger.Error("execute", op.Type+" failed").WithOp(op.Type).WithPath(slavePath).WithErr(err))
+		return err
+	}
+
+	if message != "" {
+
+		done := logger.Info("execute", message).WithOp(op.Type).WithPath(slavePath).WithDuration(time.Since(start))
+
+		if op.Type == OpCopyFile && op.Info != nil {
+			done = done.WithBytes(op.Info.Size())
+		}
+
+		e.send(done)
+	}
+
+	return nil
+}
+
+// func moves the entry at path to the trash. Without trash it is deleted with remove
+func (e *executor) delete(path, rel string, remove func(path string) error) error {
+
+	if e.trash == nil {
+		return remove(path)
+	}
+
+	dest, err := e.trash.Move(path, rel, e.stamp)
+
+	if err != nil {
+		return err
+	}
+
+	e.markTrashed()
+
+	e.send(logger.Info("execute", "moved to trash "+dest).WithPath(path))
+
+	return nil
+}
+
+// func moves a folder at path to the trash. The folder and its content are counted by the deletion limit
+// like a deleted folder: if fewer deletions are left, its entries are moved one by one and the rest is
+// moved on the next checks
+func (e *executor) trashTree(path, rel string) error {
+
+	if e.limit != nil {
+
+		count, err := countTree(e.files(), path)
+
+		if err != nil {
+			return err
+		}
+
+		if e.limit.takeAll(count+1) == nil {
+			return e.delete(path, rel, nil)
+		}
+
+		if err = e.trashContent(path, rel); err != nil {
+			return err
+		}
+	}
+
+	if err := e.limit.take(); err != nil {
+		return err
+	}
+
+	return e.delete(path, rel, nil)
+}
+
+// func moves the entries of a folder at path to the trash one by one while there are deletions left.
+// Errors of all entries are returned together like purgeTree does
+func (e *executor) trashContent(path, rel string) error {
+
+	folder, err := e.files().ReadDir(path)
+
+	if err != nil {
+		return err
+	}
+
+	purgeErr := &PurgeError{Path: path}
+
+	for _, entry := range folder {
+
+		entryPath := path + "/" + entry.Name()
+		entryRel := rel + "/" + entry.Name()
+
+		if entry.IsDir() {
+			err = e.trashTree(entryPath, entryRel)
+
+		} else if err = e.limit.take(); err == nil {
+			err = e.delete(entryPath, entryRel, nil)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if nested, ok := err.(*PurgeError); ok {
+			purgeErr.Errors = append(purgeErr.Errors, nested.Errors...)
+			continue
+		}
+
+		purgeErr.Errors = append(purgeErr.Errors, err)
+
+		if err == ErrDeleteLimit {
+			break
+		}
+	}
+
+	if len(purgeErr.Errors) > 0 {
+		return purgeErr
+	}
+
+	return nil
+}
+
+// func keeps the file at path in the trash before it is overwritten
+func (e *executor) keep(path, rel string) error {
+
+	if e.trash == nil {
+		return nil
+	}
+
+	dest, err := e.trash.Keep(path, rel, e.stamp)
+
+	if err != nil {
+		return err
+	}
+
+	e.markTrashed()
+
+	e.send(logger.Info("execute", "kept in trash "+dest).WithOp(OpCopyFile).WithPath(path))
+
+	return nil
+}
+
+// func notes that something is put into the trash, so it is cleaned after the execution
+func (e *executor) markTrashed() {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.trashed = true
+}
+
+// func logs once per execution that the rest of deletions are skipped
+func (e *executor) limitReached() {
+
+	e.limited.Do(func() {
+		e.send(logger.Error("execute", "deletion limit "+strconv.Itoa(e.maxDeletions)+" is reached, the rest of deletions are skipped until the next check"))
+	})
+}
+
+// func counts the done operation and reports the progress
+func (e *executor) report(total int, result Result) {
+
+	if e.progress == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.done++
+
+	e.progress(e.done, total, result)
+}
+
+// func stores the current state of the master file and its copy in the index
+func (e *executor) setSynced(masterFile, slaveFile string) {
+
+	if e.state == nil {
+		return
+	}
+
+	msInfo, err := e.files().Stat(masterFile)
+
+	if err != nil {
+		return
+	}
+
+	slInfo, err := e.files().Stat(slaveFile)
+
+	if err != nil {
+		return
+	}
+
+	e.state.Put(masterFile, state.NewEntry(msInfo))
+	e.state.Put(slaveFile, state.NewEntry(slInfo))
+}
+
+// func removes a deleted file or folder from the index
+func (e *executor) unsetSynced(masterPath, slavePath string) {
+
+	if e.state == nil {
+		return
+	}
+
+	e.state.Delete(masterPath)
+	e.state.Delete(slavePath)
+}
+
+const (
+	stageDeletes = iota
+	stageFolders
+	stageFiles
+	stageLinks
+	stageFolderMeta
+)
+
+// func returns the stage of the operation
+func opStage(op Operation) int {
+
+	switch op.Type {
+
+	case OpDeleteFile, OpDeleteDir:
+		return stageDeletes
+
+	case OpMkdir:
+		return stageFolders
+
+	case OpHardLink:
+		return stageLinks
+
+	case OpUpdateMeta:
+
+		if op.Info != nil && op.Info.IsDir() {
+			return stageFolderMeta
+		}
+	}
+
+	return stageFiles
+}
@@ -0,0 +1,149 @@
+package synch
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecute(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.MkdirAll(masterPath+"/a/b", 0755))
+	req.NoError(os.WriteFile(masterPath+"/a/b/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/deleted", []byte("test"), 0644))
+
+	info, err := os.Stat(masterPath + "/a")
+	req.NoError(err)
+
+	plan := &Plan{Master: masterPath, Slave: slavePath, Ops: []Operation{
+		{Type: OpDeleteFile, Path: "deleted"},
+		{Type: OpDeleteFile, Path: "gone"},
+		{Type: OpMkdir, Path: "a", Info: info},
+		{Type: OpMkdir, Path: "a/b", Info: info},
+		{Type: OpCopyFile, Path: "a/b/file1"},
+		{Type: OpSymlink, Path: "a/link", Target: "b/file1"},
+		{Type: OpHardLink, Path: "a/file2", Target: "a/b/file1"},
+	}}
+
+	var mu sync.Mutex
+	var done []int
+
+	e := &executor{workers: 4, metaWorkers: 4, progress: func(n, total int, result Result) {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		req.Equal(len(plan.Ops), total)
+		done = append(done, n)
+	}}
+
+	results := e.execute(context.Background(), plan)
+	req.Len(results, len(plan.Ops))
+
+	for i, result := range results {
+
+		req.Equal(plan.Ops[i], result.Op)
+
+		// a failed operation doesn't stop the others
+		if result.Op.Path == "gone" {
+			req.ErrorIs(result.Err, os.ErrNotExist)
+		} else {
+			req.NoError(result.Err, result.Op.Path)
+		}
+	}
+
+	req.Equal([]int{1, 2, 3, 4, 5, 6, 7}, done)
+
+	_, err = os.Stat(slavePath + "/deleted")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	data, err := os.ReadFile(slavePath + "/a/link")
+	req.NoError(err)
+	req.Equal("test", string(data))
+
+	first, err := os.Stat(slavePath + "/a/b/file1")
+	req.NoError(err)
+	second, err := os.Stat(slavePath + "/a/file2")
+	req.NoError(err)
+	req.True(os.SameFile(first, second))
+
+}
+
+func TestExecuteStop(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	plan := &Plan{Master: masterPath, Slave: slavePath}
+
+	for _, name := range []string{"file1", "file2", "file3", "file4"} {
+
+		req.NoError(os.WriteFile(masterPath+"/"+name, []byte("test"), 0644))
+		plan.Ops = append(plan.Ops, Operation{Type: OpCopyFile, Path: name, Reason: ReasonMissing})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the check is stopped after the first copy, the other copies are not started
+	e := &executor{workers: 1, metaWorkers: 1, progress: func(n, total int, result Result) {
+		cancel()
+	}}
+
+	results := e.execute(ctx, plan)
+
+	req.NoError(results[0].Err)
+
+	for _, result := range results[1:] {
+
+		req.ErrorIs(result.Err, context.Canceled)
+
+		_, err := os.Stat(slavePath + "/" + result.Op.Path)
+		req.ErrorIs(err, os.ErrNotExist)
+	}
+
+	req.Equal(3, canceled(results))
+
+}
+
+func TestCopyAbort(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("new"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/file1", []byte("old"), 0644))
+
+	abort := make(chan struct{})
+	close(abort)
+
+	// an aborted copy is rolled back, the old file stays and no temporary file is left
+	req.ErrorIs(copyFileAbort(OS, masterPath+"/file1", slavePath+"/file1", Preserve{}, abort), errCopyAborted)
+
+	data, err := os.ReadFile(slavePath + "/file1")
+	req.NoError(err)
+	req.Equal("old", string(data))
+
+	entries, err := os.ReadDir(slavePath)
+	req.NoError(err)
+	req.Len(entries, 1)
+
+	req.NoError(copyFileAbort(OS, masterPath+"/file1", slavePath+"/file1", Preserve{}, nil))
+
+	data, err = os.ReadFile(slavePath + "/file1")
+	req.NoError(err)
+	req.Equal("new", string(data))
+
+}
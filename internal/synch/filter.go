@@ -0,0 +1,298 @@
+package synch
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"synchfolder/internal/logger"
+	"time"
+)
+
+// default name of the files with exclude patterns of their folder
+const IgnoreFile string = ".syncignore"
+
+// Filter chooses entries of the source folder that are synchronized. Entries of the synch folder
+// that the filter excludes are not deleted unless DeleteExcluded is set
+type Filter struct {
+	Include        []string      // if it is set, only files matching one of the patterns are synchronized
+	Exclude        []string      // patterns in gitignore syntax, relative to the source folder
+	IgnoreFile     string        // name of files with patterns of their folder, empty means none
+	MinSize        int64         // smaller files are excluded, 0 means no limit
+	MaxSize        int64         // bigger files are excluded, 0 means no limit
+	MinAge         time.Duration // files changed later than this ago are excluded, 0 means no limit
+	MaxAge         time.Duration // files changed earlier than this ago are excluded, 0 means no limit
+	DeleteExcluded bool          // excluded entries of the synch folder are deleted
+}
+
+// filter of the synchronized entries. If it is nil everything is synchronized
+var Filters *Filter
+
+// rule is a single pattern of gitignore syntax
+type rule struct {
+	base     string // folder of the ignore file relative to the source folder, "" for the root
+	pattern  string
+	negate   bool // the pattern started with ! and includes again what was excluded
+	dirOnly  bool // the pattern ended with / and matches only folders
+	anchored bool // the pattern has a / and matches from base, otherwise it matches names at any depth
+}
+
+// matcher applies a filter to both trees. Ignore files are always read from the source folder,
+// so entries of the synch folder are matched by the same rules
+type matcher struct {
+	filter  *Filter
+	master  string
+	now     time.Time
+	include []rule
+	rules   map[string][]rule // rules of every read folder, with the rules of its parents
+	mu      sync.Mutex        // guards the rules, folders are read at the same time
+	env
+}
+
+// func returns a matcher of the filter for the source folder master of the job. A nil filter returns nil
+func newMatcher(filter *Filter, master string, e env) *matcher {
+
+	if filter == nil {
+		return nil
+	}
+
+	m := &matcher{filter: filter, master: master, now: time.Now(), rules: map[string][]rule{}, env: e}
+
+	m.rules[""] = append(parseRules("", filter.Exclude), m.readIgnore("")...)
+	m.include = parseRules("", filter.Include)
+
+	return m
+}
+
+// func parses patterns of gitignore syntax of the folder base. Empty lines and comments are skipped
+func parseRules(base string, patterns []string) []rule {
+
+	rules := []rule{}
+
+	for _, pattern := range patterns {
+
+		pattern = strings.TrimRight(pattern, " \r")
+
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		r := rule{base: base}
+
+		if strings.HasPrefix(pattern, "!") {
+			r.negate = true
+			pattern = pattern[1:]
+		}
+
+		// \# and \! are names that start with these characters
+		pattern = strings.TrimPrefix(pattern, "\\")
+
+		if strings.HasSuffix(pattern, "/") {
+			r.dirOnly = true
+			pattern = strings.TrimRight(pattern, "/")
+		}
+
+		if strings.Contains(pattern, "/") {
+			r.anchored = true
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+
+		if pattern == "" {
+			continue
+		}
+
+		r.pattern = pattern
+
+		rules = append(rules, r)
+	}
+
+	return rules
+}
+
+// func reads the ignore file of the folder of the source folder
+func (m *matcher) readIgnore(folder string) []rule {
+
+	if m.filter.IgnoreFile == "" {
+		return nil
+	}
+
+	name := path.Join(m.master, folder, m.filter.IgnoreFile)
+
+	file, err := m.files().Open(name)
+
+	if err != nil {
+
+		if !errors.Is(err, os.ErrNotExist) {
+			m.send(logger.Error("filter", "ignore file can't be read").WithPath(name).WithErr(err))
+		}
+
+		return nil
+	}
+
+	defer file.Close()
+
+	patterns := []string{}
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+
+	return parseRules(folder, patterns)
+}
+
+// func returns the rules that apply to entries of the folder
+func (m *matcher) folderRules(folder string) []rule {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.readRules(folder)
+}
+
+// func returns the rules of the folder, the ignore files of the folder and its parents are read once
+func (m *matcher) readRules(folder string) []rule {
+
+	if rules, ok := m.rules[folder]; ok {
+		return rules
+	}
+
+	parentRules := m.readRules(parent(folder))
+
+	rules := append(parentRules[:len(parentRules):len(parentRules)], m.readIgnore(folder)...)
+
+	m.rules[folder] = rules
+
+	return rules
+}
+
+// func checks if the entry at rel is excluded. A nil matcher excludes nothing
+func (m *matcher) excluded(rel string, info os.FileInfo) bool {
+
+	if m == nil || rel == "" {
+		return false
+	}
+
+	dir := info.IsDir()
+
+	// the last matching rule wins, so a later ! pattern includes again
+	excluded := false
+
+	for _, r := range m.folderRules(parent(rel)) {
+
+		if r.match(rel, dir) {
+			excluded = !r.negate
+		}
+	}
+
+	if excluded || dir {
+		return excluded
+	}
+
+	if len(m.include) > 0 && !matchAny(m.include, rel) {
+		return true
+	}
+
+	if !info.Mode().IsRegular() {
+		return false
+	}
+
+	f := m.filter
+	age := m.now.Sub(info.ModTime())
+
+	return f.MinSize > 0 && info.Size() < f.MinSize ||
+		f.MaxSize > 0 && info.Size() > f.MaxSize ||
+		f.MinAge > 0 && age < f.MinAge ||
+		f.MaxAge > 0 && age > f.MaxAge
+}
+
+// func checks if the folder rel or one of its parents is excluded, so nothing in it is synchronized
+func (m *matcher) excludedFolder(rel string, info os.FileInfo) bool {
+
+	if m == nil {
+		return false
+	}
+
+	for dir := parent(rel); dir != ""; dir = parent(dir) {
+
+		if m.excluded(dir, info) {
+			return true
+		}
+	}
+
+	return m.excluded(rel, info)
+}
+
+// func checks if any include rule matches the file
+func matchAny(rules []rule, rel string) bool {
+
+	for _, r := range rules {
+
+		if !r.negate && r.match(rel, false) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// func checks if the rule matches the entry at rel
+func (r rule) match(rel string, dir bool) bool {
+
+	if r.dirOnly && !dir {
+		return false
+	}
+
+	if r.base != "" {
+
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+
+		rel = rel[len(r.base)+1:]
+	}
+
+	if !r.anchored {
+		return matchGlob(r.pattern, path.Base(rel))
+	}
+
+	return matchSegments(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// func matches path segments, ** matches any number of segments
+func matchSegments(pattern, segments []string) bool {
+
+	for len(pattern) > 0 {
+
+		if pattern[0] == "**" {
+
+			for i := 0; i <= len(segments); i++ {
+
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 || !matchGlob(pattern[0], segments[0]) {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// func matches a name with a glob pattern of *, ? and [...]. A wrong pattern matches nothing
+func matchGlob(pattern, name string) bool {
+
+	ok, err := path.Match(pattern, name)
+
+	return err == nil && ok
+}
@@ -0,0 +1,140 @@
+package synch
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+
+	req := require.New(t)
+
+	root := t.TempDir()
+
+	req.NoError(os.MkdirAll(root+"/src/vendor", 0755))
+	req.NoError(os.WriteFile(root+"/src/"+IgnoreFile, []byte("# generated files\n*.gen.go\n!keep.gen.go\n/vendor/\n"), 0644))
+
+	// only the info of the entry matters, the paths are not read
+	file := fileInfo{name: "file", size: 100, modTime: time.Now().Add(-time.Hour)}
+	dir := fileInfo{name: "dir", mode: os.ModeDir}
+
+	filter := &Filter{
+		Exclude:    []string{".git/", "*.swp", "build/**/*.o", "/tmp", "docs/*.pdf"},
+		IgnoreFile: IgnoreFile,
+	}
+
+	cases := map[string]struct {
+		filter   *Filter
+		path     string
+		info     os.FileInfo
+		excluded bool
+	}{
+		"folder at any depth":      {filter: filter, path: "a/b/.git", info: dir, excluded: true},
+		"folder pattern for file":  {filter: filter, path: "a/.git", info: file},
+		"name at any depth":        {filter: filter, path: "a/b/.file.swp", info: file, excluded: true},
+		"double star":              {filter: filter, path: "build/x/y/main.o", info: file, excluded: true},
+		"double star no folders":   {filter: filter, path: "build/main.o", info: file, excluded: true},
+		"anchored at root":         {filter: filter, path: "tmp", info: dir, excluded: true},
+		"anchored not deeper":      {filter: filter, path: "a/tmp", info: dir},
+		"pattern with folder":      {filter: filter, path: "docs/a.pdf", info: file, excluded: true},
+		"pattern not deeper":       {filter: filter, path: "docs/a/b.pdf", info: file},
+		"ignore file":              {filter: filter, path: "src/a/main.gen.go", info: file, excluded: true},
+		"ignore file negation":     {filter: filter, path: "src/keep.gen.go", info: file},
+		"ignore file anchored":     {filter: filter, path: "src/vendor", info: dir, excluded: true},
+		"ignore file other folder": {filter: filter, path: "main.gen.go", info: file},
+		"included":                 {filter: filter, path: "a/file", info: file},
+
+		"include":              {filter: &Filter{Include: []string{"*.jpg"}}, path: "a/photo.jpg", info: file},
+		"include other":        {filter: &Filter{Include: []string{"*.jpg"}}, path: "a/notes.txt", info: file, excluded: true},
+		"include folders":      {filter: &Filter{Include: []string{"*.jpg"}}, path: "a", info: dir},
+		"exclude over include": {filter: &Filter{Include: []string{"*.jpg"}, Exclude: []string{"a/"}}, path: "a", info: dir, excluded: true},
+
+		"min size":        {filter: &Filter{MinSize: 101}, path: "file", info: file, excluded: true},
+		"max size":        {filter: &Filter{MaxSize: 99}, path: "file", info: file, excluded: true},
+		"size in limits":  {filter: &Filter{MinSize: 100, MaxSize: 100}, path: "file", info: file},
+		"size of folders": {filter: &Filter{MinSize: 101}, path: "dir", info: dir},
+		"min age":         {filter: &Filter{MinAge: 2 * time.Hour}, path: "file", info: file, excluded: true},
+		"max age":         {filter: &Filter{MaxAge: time.Minute}, path: "file", info: file, excluded: true},
+		"age in limits":   {filter: &Filter{MinAge: time.Minute, MaxAge: 2 * time.Hour}, path: "file", info: file},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			m := newMatcher(cs.filter, root, env{})
+
+			req.Equal(cs.excluded, m.excluded(cs.path, cs.info))
+		})
+	}
+
+	// everything is synchronized without a filter
+	req.False(newMatcher(nil, root, env{}).excluded("a/.git", dir))
+
+}
+
+func TestPlanFilter(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	for _, path := range []string{"/.git", "/src", "/extra/.git", "/gone"} {
+		req.NoError(os.MkdirAll(slavePath+path, 0755))
+	}
+
+	req.NoError(os.MkdirAll(masterPath+"/.git", 0755))
+	req.NoError(os.MkdirAll(masterPath+"/src", 0755))
+
+	for _, path := range []string{"/.git/HEAD", "/src/main.go", "/src/main.swp"} {
+		req.NoError(os.WriteFile(masterPath+path, []byte("test"), 0644))
+	}
+
+	req.NoError(os.WriteFile(masterPath+"/big", []byte("too big to copy"), 0644))
+
+	for _, path := range []string{"/.git/HEAD", "/src/old.swp", "/extra/file", "/extra/.git/HEAD", "/gone/file", "/big"} {
+		req.NoError(os.WriteFile(slavePath+path, []byte("test"), 0644))
+	}
+
+	job := &Job{Master: masterPath, Slave: slavePath, Options: Options{
+		Compare: CompareSHA256,
+		Filter:  &Filter{Exclude: []string{".git/", "*.swp"}, MaxSize: 10},
+	}}
+
+	ops := func() []string {
+
+		plan, err := job.DryRun()
+		req.NoError(err)
+
+		list := []string{}
+
+		for _, op := range plan.Ops {
+			list = append(list, op.Type+" "+op.Path+" "+op.Reason)
+		}
+
+		return list
+	}
+
+	// excluded entries of the synch folder and their folders are kept,
+	// the old copy of a file that is excluded by its size too
+	req.Equal([]string{
+		"DELETE extra/file extra in replica",
+		"RMDIR gone extra in replica",
+		"COPY src/main.go missing in replica",
+	}, ops())
+
+	job.Filter.DeleteExcluded = true
+
+	req.Equal([]string{
+		"DELETE big excluded by filter",
+		"RMDIR extra extra in replica",
+		"RMDIR gone extra in replica",
+		"RMDIR .git excluded by filter",
+		"DELETE src/old.swp excluded by filter",
+		"COPY src/main.go missing in replica",
+	}, ops())
+
+}
@@ -0,0 +1,78 @@
+package synch
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// FS is the file system of the source and synch folders. Paths are paths of the system, like the ones
+// of the os package. Extended attributes, special files and flushing folders to disk are supported only by OS
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	Readlink(name string) (string, error)
+	Open(name string) (io.ReadCloser, error)
+	Create(name string, perm os.FileMode) (File, error) // the file must not exist
+	Mkdir(name string, perm os.FileMode) error
+	Rename(oldname, newname string) error
+	Remove(name string) error
+	Symlink(oldname, newname string) error
+	Link(oldname, newname string) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Lchown(name string, uid, gid int) error
+}
+
+// File is a new file of FS that is being written
+type File interface {
+	io.Writer
+	io.Closer
+	Sync() error
+}
+
+// OS is the file system of the operating system, it is used when the options have no FS
+var OS FS = osFS{}
+
+// osFS calls the os package
+type osFS struct{}
+
+func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) Lstat(name string) (os.FileInfo, error) { return os.Lstat(name) }
+
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+
+func (osFS) Readlink(name string) (string, error) { return os.Readlink(name) }
+
+func (osFS) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+
+func (osFS) Create(name string, perm os.FileMode) (File, error) {
+
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+}
+
+func (osFS) Mkdir(name string, perm os.FileMode) error { return os.Mkdir(name, perm) }
+
+func (osFS) Rename(oldname, newname string) error { return os.Rename(oldname, newname) }
+
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+func (osFS) Symlink(oldname, newname string) error { return os.Symlink(oldname, newname) }
+
+func (osFS) Link(oldname, newname string) error { return os.Link(oldname, newname) }
+
+func (osFS) Chmod(name string, mode os.FileMode) error { return os.Chmod(name, mode) }
+
+func (osFS) Chtimes(name string, atime, mtime time.Time) error { return os.Chtimes(name, atime, mtime) }
+
+func (osFS) Lchown(name string, uid, gid int) error { return os.Lchown(name, uid, gid) }
+
+// func checks if fsys is the file system of the operating system
+func native(fsys FS) bool {
+
+	_, ok := fsys.(osFS)
+
+	return ok
+}
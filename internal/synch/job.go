@@ -0,0 +1,361 @@
+package synch
+
+import (
+	"context"
+	"synchfolder/internal/logger"
+	"synchfolder/internal/state"
+	"synchfolder/internal/trash"
+	"time"
+)
+
+// Options are the settings of a sync job
+type Options struct {
+	FS           FS     // file system of the folders, OS if it is nil
+	Logger       Logger // receives log messages, logger.Send if it is nil
+	Compare      string
+	Comparator   Comparator // if it is set, it is used instead of Compare
+	Preserve     Preserve
+	Symlinks     string
+	Specials     string
+	HardLinks    bool
+	MaxDeletions int
+	Workers      int // copies of the job executed at the same time
+	MetaWorkers  int // metadata operations of the job executed at the same time, Workers if it is 0
+	Pool         *Pool
+	State        *state.DB
+	Trash        *trash.Trash
+	Breaker      *Breaker
+	Filter       *Filter
+	Drain        time.Duration // how long copies in progress may go on after the check is stopped
+	Progress     func(done, total int, result Result)
+}
+
+// Job keeps a synch folder the same as a source folder
+type Job struct {
+	Name   string
+	Master string
+	Slave  string
+	Options
+
+	// gets a signal when the job can't go on. If it is nil CriticalChan is used
+	Critical chan struct{}
+}
+
+// Pool limits the number of operations executed at the same time by all jobs. Copies of file data
+// and metadata operations (folders, links, attributes and deletions) have separate slots, so big copies
+// don't hold back cheap operations. Every job also has its own limits of workers, so a big job leaves free slots for others
+type Pool struct {
+	data chan struct{}
+	meta chan struct{}
+}
+
+// func returns a pool of size slots for copies and size slots for metadata operations
+func NewPool(size int) *Pool {
+
+	return NewPoolLimits(size, size)
+}
+
+// func returns a pool of data slots for copies and meta slots for metadata operations
+func NewPoolLimits(data, meta int) *Pool {
+
+	if data < 1 {
+		data = 1
+	}
+
+	if meta < 1 {
+		meta = 1
+	}
+
+	return &Pool{data: make(chan struct{}, data), meta: make(chan struct{}, meta)}
+}
+
+// func waits for a free slot for op. A nil pool has always a free slot
+func (p *Pool) acquire(op Operation) {
+
+	if p != nil {
+		p.slots(op) <- struct{}{}
+	}
+}
+
+// func frees the slot of op
+func (p *Pool) release(op Operation) {
+
+	if p != nil {
+		<-p.slots(op)
+	}
+}
+
+// func returns the slots of the class of op
+func (p *Pool) slots(op Operation) chan struct{} {
+
+	if dataOp(op) {
+		return p.data
+	}
+
+	return p.meta
+}
+
+// env is what parts of a job share: its file system, logger and name for log messages
+type env struct {
+	fs  FS
+	log Logger
+	job string
+}
+
+// func returns the file system of the job
+func (e env) files() FS {
+
+	if e.fs == nil {
+		return OS
+	}
+
+	return e.fs
+}
+
+// func sends the message to the logger of the job. Messages are marked with the job name
+func (e env) send(message logger.LogMessage) {
+
+	if message.Job == "" {
+		message.Job = e.job
+	}
+
+	if e.log == nil {
+		logger.Send(message)
+		return
+	}
+
+	e.log.Log(message)
+}
+
+// func returns options with the current settings of the package
+func GlobalOptions() Options {
+
+	return Options{
+		Compare:      CompareMode,
+		Preserve:     PreserveMeta,
+		Symlinks:     Symlinks,
+		Specials:     Specials,
+		HardLinks:    HardLinks,
+		MaxDeletions: MaxDeletions,
+		Workers:      Workers,
+		MetaWorkers:  MetaWorkers,
+		State:        State,
+		Trash:        Trash,
+		Breaker:      CircuitBreaker,
+		Filter:       Filters,
+		Drain:        DrainTimeout,
+		Progress:     Progress,
+	}
+}
+
+// func returns a job without a name with the current settings of the package
+func globalJob(masterPath, slavePath string) *Job {
+
+	return &Job{Master: masterPath, Slave: slavePath, Options: GlobalOptions()}
+}
+
+// func returns the number of copies and metadata operations of the job executed at the same time.
+// Folders are read by metadata workers
+func (o Options) limits() (int, int) {
+
+	workers := o.Workers
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	meta := o.MetaWorkers
+
+	if meta < 1 {
+		meta = workers
+	}
+
+	return workers, meta
+}
+
+// func returns the file system, logger and name of the job
+func (j *Job) environment() env {
+
+	return env{fs: j.FS, log: j.Logger, job: j.Name}
+}
+
+// func synchronizes the synch folder with the source folder: it scans both trees, plans
+// the operations and executes them. The error is returned only if the check can't be made
+func (j *Job) Synch() ([]Result, error) {
+
+	return j.SynchContext(context.Background())
+}
+
+// func is Synch that stops when ctx is done. Operations that are not started get the error of ctx,
+// copies in progress are finished or rolled back after the drain time
+func (j *Job) SynchContext(ctx context.Context) ([]Result, error) {
+
+	_, results, err := j.synchFolders(ctx, []string{""}, true, nil)
+
+	return results, err
+}
+
+// func is SynchContext that returns the plan, the executed operations and entries that couldn't be read
+// or compared. They are counted in the errors of the summary
+func (j *Job) Check(ctx context.Context) (*SyncResult, error) {
+
+	plan, results, err := j.synchFolders(ctx, []string{""}, true, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newSyncResult(plan, results), nil
+}
+
+// func checks only entries of the given folders without their subfolders.
+// Folders are relative to the source and synch folders
+func (j *Job) CheckFolders(folders []string) error {
+
+	return j.CheckFoldersContext(context.Background(), folders)
+}
+
+// func is CheckFolders that stops when ctx is done
+func (j *Job) CheckFoldersContext(ctx context.Context, folders []string) error {
+
+	_, _, err := j.synchFolders(ctx, folders, false, nil)
+
+	return err
+}
+
+// func walks source and synch folders without changing anything and returns the operations that would be made
+func (j *Job) DryRun() (*Plan, error) {
+
+	return j.planFolders(context.Background(), []string{""}, true)
+}
+
+// func removes temporary files left in the synch folder by copies that were interrupted
+func (j *Job) CleanTempFiles() error {
+
+	return cleanTempFiles(j.Master, j.Slave, j.environment())
+}
+
+// func removes old entries of the trash of the job
+func (j *Job) CleanTrash() {
+
+	cleanTrash(j.Trash, j.environment())
+}
+
+// func plans and executes operations for the given folders. If keep is set only operations it keeps are executed
+func (j *Job) synchFolders(ctx context.Context, folders []string, recursive bool, keep func(op Operation) bool) (*Plan, []Result, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	plan, err := j.planFolders(ctx, folders, recursive)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if keep != nil {
+
+		ops := plan.Ops[:0:0]
+
+		for _, op := range plan.Ops {
+
+			if keep(op) {
+				ops = append(ops, op)
+			}
+		}
+
+		plan.Ops = ops
+	}
+
+	err = j.Breaker.check(plan, recursive && len(folders) == 1 && folders[0] == "", j.environment())
+
+	if err != nil {
+		j.critical()
+		return nil, nil, err
+	}
+
+	return plan, newExecutor(j).execute(ctx, plan), nil
+}
+
+// func scans the given folders of both trees and plans operations for them. Entries that
+// couldn't be read are logged and are in the errors of the plan. The error of ctx is returned
+// if it is done while the trees are read or compared
+func (j *Job) planFolders(ctx context.Context, folders []string, recursive bool) (*Plan, error) {
+
+	e := j.environment()
+
+	// both trees are filtered by the rules of the source folder
+	m := newMatcher(j.Filter, j.Master, e)
+
+	_, workers := j.limits()
+
+	// the trees are read at the same time
+	var slave *Snapshot
+	var slaveErr error
+
+	scanned := make(chan struct{})
+
+	go func() {
+
+		defer close(scanned)
+
+		slave, slaveErr = scanFolders(ctx, e.files(), j.Slave, folders, recursive, false, m, workers)
+	}()
+
+	master, err := scanFolders(ctx, e.files(), j.Master, folders, recursive, j.Symlinks == SymlinkFollow, m, workers)
+
+	<-scanned
+
+	// a stopped check is not a critical error
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err != nil {
+		e.send(logger.Critical("planFolders", "error reading master folder").WithPath(j.Master).WithErr(err))
+		j.critical()
+		return nil, err
+	}
+
+	if err = slaveErr; err != nil {
+		e.send(logger.Critical("planFolders", "error reading slave folder").WithPath(j.Slave).WithErr(err))
+		j.critical()
+		return nil, err
+	}
+
+	plan := newPlanner(j.Options, e).plan(ctx, master, slave)
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range []*Snapshot{master, slave} {
+
+		for _, path := range snapshot.errorPaths() {
+
+			e.send(logger.Error("Scan", "entry can't be read").WithPath(snapshot.path(path)).WithErr(snapshot.Errors[path]))
+
+			if _, ok := plan.Errors[path]; !ok {
+				plan.Errors[path] = snapshot.Errors[path]
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// func signals a critical error of the job. Nobody may listen, then the signal is dropped
+func (j *Job) critical() {
+
+	ch := j.Critical
+
+	if ch == nil {
+		ch = CriticalChan
+	}
+
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,301 @@
+package synch
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowFS is the file system of the system where creating files and links is slow.
+// It finds the most files and links created at the same time
+type slowFS struct {
+	FS
+
+	mu      sync.Mutex
+	running map[string]int
+	most    map[string]int
+}
+
+// func counts a running call of the kind while it lasts
+func (f *slowFS) slow(kind string) func() {
+
+	f.mu.Lock()
+	f.running[kind]++
+	if f.running[kind] > f.most[kind] {
+		f.most[kind] = f.running[kind]
+	}
+	f.mu.Unlock()
+
+	time.Sleep(2 * time.Millisecond)
+
+	return func() {
+		f.mu.Lock()
+		f.running[kind]--
+		f.mu.Unlock()
+	}
+}
+
+func (f *slowFS) Create(name string, perm os.FileMode) (File, error) {
+
+	defer f.slow("copy")()
+
+	return f.FS.Create(name, perm)
+}
+
+func (f *slowFS) Symlink(oldname, newname string) error {
+
+	defer f.slow("link")()
+
+	return f.FS.Symlink(oldname, newname)
+}
+
+func TestPool(t *testing.T) {
+
+	req := require.New(t)
+
+	pool := NewPoolLimits(2, 3)
+
+	copyOp := Operation{Type: OpCopyFile}
+	metaOp := Operation{Type: OpSymlink}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	running := map[string]int{}
+	most := map[string]int{}
+
+	for i := 0; i < 20; i++ {
+
+		op := copyOp
+
+		if i%2 == 1 {
+			op = metaOp
+		}
+
+		wg.Add(1)
+
+		go func(op Operation) {
+
+			defer wg.Done()
+
+			pool.acquire(op)
+			defer pool.release(op)
+
+			mu.Lock()
+			running[op.Type]++
+			if running[op.Type] > most[op.Type] {
+				most[op.Type] = running[op.Type]
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			running[op.Type]--
+			mu.Unlock()
+		}(op)
+	}
+
+	wg.Wait()
+
+	// copies and metadata operations have their own slots
+	req.Equal(map[string]int{OpCopyFile: 2, OpSymlink: 3}, most)
+
+	// a nil pool doesn't limit anything
+	var none *Pool
+	none.acquire(copyOp)
+	none.release(copyOp)
+
+}
+
+func TestExecuteLimits(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	for n := 0; n < 30; n++ {
+		req.NoError(os.WriteFile(masterPath+"/file"+strconv.Itoa(n), []byte("test"), 0644))
+		req.NoError(os.Symlink("file"+strconv.Itoa(n), masterPath+"/link"+strconv.Itoa(n)))
+	}
+
+	fsys := &slowFS{FS: OS, running: map[string]int{}, most: map[string]int{}}
+
+	job := &Job{Name: "limits", Master: masterPath, Slave: slavePath, Options: Options{
+		FS:          fsys,
+		Logger:      Discard,
+		Compare:     CompareSize,
+		Workers:     2,
+		MetaWorkers: 3,
+		Pool:        NewPoolLimits(8, 8),
+	}}
+
+	results, err := job.Synch()
+	req.NoError(err)
+	req.Len(results, 60)
+
+	for _, result := range results {
+		req.NoError(result.Err)
+	}
+
+	// a job doesn't take more workers than its limits even if the pool has free slots
+	req.Equal(map[string]int{"copy": 2, "link": 3}, fsys.most)
+
+	// the shared pool limits all jobs
+	fsys = &slowFS{FS: OS, running: map[string]int{}, most: map[string]int{}}
+
+	job.FS = fsys
+	job.Slave = t.TempDir()
+	job.Pool = NewPoolLimits(1, 1)
+
+	_, err = job.Synch()
+	req.NoError(err)
+	req.Equal(map[string]int{"copy": 1, "link": 1}, fsys.most)
+
+}
+
+func TestJobs(t *testing.T) {
+
+	req := require.New(t)
+
+	pool := NewPool(2)
+
+	// signals left by other tests
+	for len(CriticalChan) > 0 {
+		<-CriticalChan
+	}
+
+	jobs := []*Job{}
+
+	for i := 0; i < 3; i++ {
+
+		masterPath := t.TempDir()
+
+		for n := 0; n < 20; n++ {
+			req.NoError(os.WriteFile(masterPath+"/file"+strconv.Itoa(n), []byte("test"), 0644))
+		}
+
+		jobs = append(jobs, &Job{
+			Name:     "job" + strconv.Itoa(i),
+			Master:   masterPath,
+			Slave:    t.TempDir(),
+			Options:  Options{Compare: CompareSHA256, Workers: 2, Pool: pool, Breaker: &Breaker{Sentinel: ".sentinel"}},
+			Critical: make(chan struct{}, 1),
+		})
+	}
+
+	// only the first job has its sentinel, the others are aborted
+	req.NoError(os.WriteFile(jobs[0].Master+"/.sentinel", []byte{}, 0644))
+
+	var wg sync.WaitGroup
+
+	errs := make([]error, len(jobs))
+
+	for i, job := range jobs {
+
+		wg.Add(1)
+
+		go func(i int, job *Job) {
+
+			defer wg.Done()
+
+			_, errs[i] = job.Synch()
+
+		}(i, job)
+	}
+
+	wg.Wait()
+
+	req.NoError(errs[0])
+
+	entries, err := os.ReadDir(jobs[0].Slave)
+	req.NoError(err)
+	req.Len(entries, 21)
+
+	for i, job := range jobs[1:] {
+
+		var breakerErr *BreakerError
+		req.ErrorAs(errs[i+1], &breakerErr)
+
+		// a critical error stops only its job
+		req.Len(job.Critical, 1)
+
+		entries, err := os.ReadDir(job.Slave)
+		req.NoError(err)
+		req.Empty(entries)
+	}
+
+	req.Empty(jobs[0].Critical)
+	req.Empty(CriticalChan)
+
+	plan, err := jobs[1].DryRun()
+	req.NoError(err)
+	req.Len(plan.Ops, 20)
+
+}
+
+func TestSynchContext(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("test"), 0644))
+
+	job := &Job{Name: "stopped", Master: masterPath, Slave: slavePath, Options: Options{Compare: CompareSize, Workers: 2}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// a stopped check doesn't read the folders and changes nothing
+	results, err := job.SynchContext(ctx)
+	req.ErrorIs(err, context.Canceled)
+	req.Empty(results)
+
+	req.ErrorIs(job.CheckFoldersContext(ctx, []string{""}), context.Canceled)
+
+	_, err = os.Stat(slavePath + "/file1")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	results, err = job.SynchContext(context.Background())
+	req.NoError(err)
+	req.Len(results, 1)
+
+}
+
+func TestCheck(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("test"), 0644))
+	req.NoError(os.Symlink(masterPath+"/missing", masterPath+"/dangling"))
+
+	job := &Job{Name: "follow", Master: masterPath, Slave: slavePath,
+		Options: Options{Compare: CompareSize, Symlinks: SymlinkFollow, Workers: 2, Logger: Discard}}
+
+	// the dangling link can't be followed, it is an error of the check
+	check, err := job.Check(context.Background())
+	req.NoError(err)
+	req.Len(check.Results, 1)
+	req.Equal([]string{"dangling"}, check.Plan.ErrorPaths())
+	req.Contains(check.Errors, "dangling")
+	req.Equal(1, check.Summary.Copied)
+	req.Equal(1, check.Summary.Errors)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = job.Check(ctx)
+	req.ErrorIs(err, context.Canceled)
+
+}
@@ -0,0 +1,83 @@
+package synch
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	SymlinkCopy   string = "COPY"
+	SymlinkFollow string = "FOLLOW"
+	SymlinkSkip   string = "SKIP"
+
+	SpecialSkip     string = "SKIP"
+	SpecialRecreate string = "RECREATE"
+)
+
+// policy for symbolic links in the source folder
+var Symlinks string
+
+// policy for fifos, sockets and devices in the source folder
+var Specials string
+
+// if set, files hard linked in the source folder are hard linked in the synch folder too
+var HardLinks bool
+
+func init() {
+
+	Symlinks = SymlinkCopy
+	Specials = SpecialSkip
+}
+
+// func sets the policy for symbolic links
+func SetSymlinks(policy string) error {
+
+	policy = strings.ToUpper(policy)
+
+	if policy == SymlinkCopy || policy == SymlinkFollow || policy == SymlinkSkip {
+		Symlinks = policy
+
+	} else {
+		return errors.New("symlinks policy is not set in config. Default policy COPY")
+	}
+
+	return nil
+}
+
+// func sets the policy for fifos, sockets and devices
+func SetSpecials(policy string) error {
+
+	policy = strings.ToUpper(policy)
+
+	if policy == SpecialSkip || policy == SpecialRecreate {
+		Specials = policy
+
+	} else {
+		return errors.New("specials policy is not set in config. Default policy SKIP")
+	}
+
+	return nil
+}
+
+// func creates an entry of fsys with create under a temporary name and renames it to path
+func replaceEntry(fsys FS, path string, create func(tmp string) error) error {
+
+	tmp := tempName(path)
+
+	if err := create(tmp); err != nil {
+		return err
+	}
+
+	if err := fsys.Rename(tmp, path); err != nil {
+		fsys.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// fileKey identifies a file on a device
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
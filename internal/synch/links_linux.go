@@ -0,0 +1,78 @@
+//go:build linux
+
+package synch
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// func returns the key of the file and the number of its hard links
+func linkKey(info os.FileInfo) (fileKey, uint64) {
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return fileKey{}, 0
+	}
+
+	return fileKey{dev: uint64(st.Dev), ino: st.Ino}, uint64(st.Nlink)
+}
+
+// func returns the device of the file
+func device(info os.FileInfo) (uint64, bool) {
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(st.Dev), true
+}
+
+// func checks if two special files have the same type and device number
+func sameSpecial(a, b os.FileInfo) bool {
+
+	if a.Mode().Type() != b.Mode().Type() {
+		return false
+	}
+
+	stA, okA := a.Sys().(*syscall.Stat_t)
+	stB, okB := b.Sys().(*syscall.Stat_t)
+
+	return okA && okB && stA.Rdev == stB.Rdev
+}
+
+// func creates a fifo, socket or device at path like the one described by info
+func makeSpecial(path string, info os.FileInfo) error {
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return errors.New("unknown special file " + info.Name())
+	}
+
+	var mode uint32
+
+	switch {
+
+	case info.Mode()&os.ModeNamedPipe != 0:
+		mode = syscall.S_IFIFO
+
+	case info.Mode()&os.ModeSocket != 0:
+		mode = syscall.S_IFSOCK
+
+	case info.Mode()&os.ModeCharDevice != 0:
+		mode = syscall.S_IFCHR
+
+	case info.Mode()&os.ModeDevice != 0:
+		mode = syscall.S_IFBLK
+
+	default:
+		return errors.New("unknown special file " + info.Name())
+	}
+
+	return os.NewSyscallError("mknod "+path, syscall.Mknod(path, mode|uint32(info.Mode().Perm()), int(st.Rdev)))
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package synch
+
+import (
+	"errors"
+	"os"
+)
+
+// func returns the key of the file and the number of its hard links. They are not supported on this system
+func linkKey(info os.FileInfo) (fileKey, uint64) {
+
+	return fileKey{}, 0
+}
+
+// func checks if two special files have the same type
+func sameSpecial(a, b os.FileInfo) bool {
+
+	return a.Mode().Type() == b.Mode().Type()
+}
+
+// func creates a fifo, socket or device at path. It is not supported on this system
+func makeSpecial(path string, info os.FileInfo) error {
+
+	return errors.New("special files are not supported on this system")
+}
+
+// func returns the device of the file. Devices are not checked on this system
+func device(info os.FileInfo) (uint64, bool) {
+
+	return 0, false
+}
@@ -0,0 +1,201 @@
+package synch
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// Preserve is a set of file attributes copied from the source to the synch folder
+type Preserve struct {
+	Mode   bool // permission bits, setuid, setgid and sticky bits
+	Times  bool // modification and access time
+	Owner  bool // uid and gid, only when running as root
+	Xattrs bool // extended attributes
+}
+
+// attributes preserved in the synch folder. Nothing is preserved by default
+var PreserveMeta Preserve
+
+// func sets the attributes preserved in the synch folder from a comma separated list
+// of mode, times, owner and xattrs. all means every attribute, empty value means none
+func SetPreserve(list string) error {
+
+	preserve, err := ParsePreserve(list)
+
+	if err != nil {
+		return err
+	}
+
+	PreserveMeta = preserve
+
+	return nil
+}
+
+// func returns the attributes of a comma separated list like SetPreserve does
+func ParsePreserve(list string) (Preserve, error) {
+
+	var preserve Preserve
+
+	for _, item := range strings.Split(strings.ToLower(list), ",") {
+
+		switch strings.TrimSpace(item) {
+
+		case "":
+
+		case "all":
+			preserve = Preserve{Mode: true, Times: true, Owner: true, Xattrs: true}
+
+		case "mode":
+			preserve.Mode = true
+
+		case "times":
+			preserve.Times = true
+
+		case "owner":
+			preserve.Owner = true
+
+		case "xattrs":
+			preserve.Xattrs = true
+
+		default:
+			return Preserve{}, errors.New("unknown attribute " + item + " in preserve. Attributes are not preserved")
+		}
+	}
+
+	return preserve, nil
+}
+
+// func checks if any attribute has to be preserved
+func (p Preserve) enabled() bool {
+
+	return p.Mode || p.Times || p.Owner || p.Xattrs
+}
+
+// func checks if the preserved attributes of the copy are the same as of the source.
+// Extended attributes are checked only on the file system of the operating system
+func (p Preserve) equal(fsys FS, masterPath, slavePath string, msInfo, slInfo os.FileInfo) (bool, error) {
+
+	if p.Mode && msInfo.Mode() != slInfo.Mode() {
+		return false, nil
+	}
+
+	if p.Times && !msInfo.ModTime().Equal(slInfo.ModTime()) {
+		return false, nil
+	}
+
+	if p.Owner && canChown() {
+
+		msUid, msGid := owner(msInfo)
+		slUid, slGid := owner(slInfo)
+
+		if msUid != slUid || msGid != slGid {
+			return false, nil
+		}
+	}
+
+	if p.Xattrs && native(fsys) {
+
+		msAttrs, err := xattrs(masterPath)
+
+		if err != nil {
+			return false, err
+		}
+
+		slAttrs, err := xattrs(slavePath)
+
+		if err != nil {
+			return false, err
+		}
+
+		if len(msAttrs) != len(slAttrs) {
+			return false, nil
+		}
+
+		for name, value := range msAttrs {
+
+			if slValue, ok := slAttrs[name]; !ok || slValue != value {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// func copies the preserved attributes of the source file msInfo to slavePath of fsys.
+// Times go last because changing other attributes doesn't change them
+func (p Preserve) apply(fsys FS, masterPath, slavePath string, msInfo os.FileInfo) error {
+
+	if p.Xattrs && native(fsys) {
+
+		if err := copyXattrs(masterPath, slavePath); err != nil {
+			return err
+		}
+	}
+
+	// chown resets setuid and setgid bits, so it goes before chmod
+	if p.Owner && canChown() {
+
+		uid, gid := owner(msInfo)
+
+		if err := fsys.Lchown(slavePath, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	if p.Mode {
+
+		if err := fsys.Chmod(slavePath, msInfo.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+	}
+
+	if p.Times {
+
+		if err := fsys.Chtimes(slavePath, accessTime(msInfo), msInfo.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// func sets extended attributes of slavePath to the ones of masterPath
+func copyXattrs(masterPath, slavePath string) error {
+
+	msAttrs, err := xattrs(masterPath)
+
+	if err != nil {
+		return err
+	}
+
+	slAttrs, err := xattrs(slavePath)
+
+	if err != nil {
+		return err
+	}
+
+	for name := range slAttrs {
+
+		if _, ok := msAttrs[name]; !ok {
+
+			if err = removeXattr(slavePath, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, value := range msAttrs {
+
+		if slValue, ok := slAttrs[name]; ok && slValue == value {
+			continue
+		}
+
+		if err = setXattr(slavePath, name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+//go:build linux
+
+package synch
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// func checks if the process is allowed to change the owner of files
+func canChown() bool {
+
+	return os.Geteuid() == 0
+}
+
+// func returns uid and gid of the file
+func owner(info os.FileInfo) (int, int) {
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return -1, -1
+	}
+
+	return int(st.Uid), int(st.Gid)
+}
+
+// func returns the last access time of the file
+func accessTime(info os.FileInfo) time.Time {
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return info.ModTime()
+	}
+
+	return time.Unix(st.Atim.Sec, st.Atim.Nsec)
+}
+
+// func returns extended attributes of the file. A file system without
+// extended attributes support is treated as a file without attributes
+func xattrs(path string) (map[string]string, error) {
+
+	size, err := syscall.Listxattr(path, nil)
+
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, os.NewSyscallError("listxattr "+path, err)
+	}
+
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+
+	size, err = syscall.Listxattr(path, buf)
+
+	if err != nil {
+		return nil, os.NewSyscallError("listxattr "+path, err)
+	}
+
+	attrs := map[string]string{}
+
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+
+		if name == "" {
+			continue
+		}
+
+		size, err := syscall.Getxattr(path, name, nil)
+
+		if err != nil {
+			return nil, os.NewSyscallError("getxattr "+path, err)
+		}
+
+		value := make([]byte, size)
+
+		size, err = syscall.Getxattr(path, name, value)
+
+		if err != nil {
+			return nil, os.NewSyscallError("getxattr "+path, err)
+		}
+
+		attrs[name] = string(value[:size])
+	}
+
+	return attrs, nil
+}
+
+// func sets an extended attribute of the file
+func setXattr(path, name, value string) error {
+
+	return os.NewSyscallError("setxattr "+path, syscall.Setxattr(path, name, []byte(value), 0))
+}
+
+// func removes an extended attribute of the file
+func removeXattr(path, name string) error {
+
+	return os.NewSyscallError("removexattr "+path, syscall.Removexattr(path, name))
+}
@@ -0,0 +1,44 @@
+//go:build !linux
+
+package synch
+
+import (
+	"os"
+	"time"
+)
+
+// func checks if the process is allowed to change the owner of files
+func canChown() bool {
+
+	return false
+}
+
+// func returns uid and gid of the file. They are not supported on this system
+func owner(info os.FileInfo) (int, int) {
+
+	return -1, -1
+}
+
+// func returns the last access time of the file. It is not supported on this system
+func accessTime(info os.FileInfo) time.Time {
+
+	return info.ModTime()
+}
+
+// func returns extended attributes of the file. They are not supported on this system
+func xattrs(path string) (map[string]string, error) {
+
+	return nil, nil
+}
+
+// func sets an extended attribute of the file
+func setXattr(path, name, value string) error {
+
+	return nil
+}
+
+// func removes an extended attribute of the file
+func removeXattr(path, name string) error {
+
+	return nil
+}
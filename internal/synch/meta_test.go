@@ -0,0 +1,145 @@
+package synch
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"synchfolder/internal/state"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPreserve(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { PreserveMeta = Preserve{} }()
+
+	cases := map[string]struct {
+		list     string
+		preserve Preserve
+		isError  bool
+		errMsg   string
+	}{
+		"empty": {
+			list: "",
+		},
+
+		"all": {
+			list:     "ALL",
+			preserve: Preserve{Mode: true, Times: true, Owner: true, Xattrs: true},
+		},
+
+		"list with spaces": {
+			list:     "mode, times",
+			preserve: Preserve{Mode: true, Times: true},
+		},
+
+		"unknown attribute": {
+			list:    "mode,acl",
+			isError: true,
+			errMsg:  "unknown attribute acl in preserve",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := SetPreserve(cs.list)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+				req.Equal(cs.preserve, PreserveMeta)
+			}
+		})
+	}
+
+}
+
+func TestPreserveMeta(t *testing.T) {
+
+	req := require.New(t)
+
+	PreserveMeta = Preserve{Mode: true, Times: true, Owner: true, Xattrs: true}
+	defer func() { PreserveMeta = Preserve{} }()
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	mtime := time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC)
+
+	req.NoError(os.Mkdir(masterPath+"/dir", 0750))
+	req.NoError(os.WriteFile(masterPath+"/dir/file1", []byte("test"), 0644))
+	req.NoError(os.Chmod(masterPath+"/dir/file1", 0751))
+	req.NoError(os.Chtimes(masterPath+"/dir/file1", mtime, mtime))
+	req.NoError(os.Chtimes(masterPath+"/dir", mtime, mtime))
+
+	hasXattrs := true
+
+	err := setXattr(masterPath+"/dir/file1", "user.test", "value")
+
+	if errors.Is(err, syscall.ENOTSUP) {
+		hasXattrs = false
+	} else {
+		req.NoError(err)
+	}
+
+	req.NoError(CheckMasterFolder(masterPath, slavePath))
+
+	checkAttrs := func(path string, mode os.FileMode) {
+
+		info, err := os.Stat(path)
+		req.NoError(err)
+		req.Equal(mode, info.Mode().Perm())
+		req.True(mtime.Equal(info.ModTime()), info.ModTime().String())
+	}
+
+	checkAttrs(slavePath+"/dir/file1", 0751)
+	checkAttrs(slavePath+"/dir", 0750)
+
+	if hasXattrs {
+		attrs, err := xattrs(slavePath + "/dir/file1")
+		req.NoError(err)
+		req.Equal(map[string]string{"user.test": "value"}, attrs)
+	}
+
+	// only metadata is changed in the source
+	req.NoError(os.Chmod(masterPath+"/dir/file1", 0700))
+	req.NoError(os.Chtimes(masterPath+"/dir/file1", mtime, mtime))
+
+	req.NoError(CheckMasterFolder(masterPath, slavePath))
+
+	checkAttrs(slavePath+"/dir/file1", 0700)
+
+	if !hasXattrs {
+		return
+	}
+
+	// a change of only xattrs is found when the state knows the file is synchronized
+	db, err := state.Open(t.TempDir() + "/state.json")
+	req.NoError(err)
+
+	State = db
+	defer func() { State = nil }()
+
+	req.NoError(CheckMasterFolder(masterPath, slavePath))
+
+	info, err := os.Stat(masterPath + "/dir/file1")
+	req.NoError(err)
+	req.True(db.Unchanged(masterPath+"/dir/file1", info))
+
+	req.NoError(setXattr(masterPath+"/dir/file1", "user.test", "changed"))
+
+	req.NoError(CheckMasterFolder(masterPath, slavePath))
+
+	attrs, err := xattrs(slavePath + "/dir/file1")
+	req.NoError(err)
+	req.Equal(map[string]string{"user.test": "changed"}, attrs)
+
+}
@@ -0,0 +1,538 @@
+package synch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"synchfolder/internal/logger"
+	"synchfolder/internal/state"
+	"synchfolder/internal/trash"
+)
+
+const (
+	OpMkdir      string = "MKDIR"
+	OpCopyFile   string = "COPY"
+	OpUpdateMeta string = "META"
+	OpDeleteFile string = "DELETE"
+	OpDeleteDir  string = "RMDIR"
+	OpSymlink    string = "SYMLINK"
+	OpHardLink   string = "LINK"
+	OpSpecial    string = "MKNOD"
+
+	ReasonMissing  string = "missing in replica"
+	ReasonSize     string = "size differs"
+	ReasonModTime  string = "time differs"
+	ReasonHash     string = "hash differs"
+	ReasonContent  string = "content differs"
+	ReasonType     string = "type differs"
+	ReasonMeta     string = "attributes differ"
+	ReasonTarget   string = "link target differs"
+	ReasonHardLink string = "hard link differs"
+	ReasonExtra    string = "extra in replica"
+	ReasonExcluded string = "excluded by filter"
+)
+
+// Operation is a single change of the synch folder
+type Operation struct {
+	Type   string
+	Path   string      // path relative to source and synch folders
+	Reason string      // why the operation is needed
+	Info   os.FileInfo // info of the source entry, nil for deletions
+	Target string      // target of a symlink or the path of the first hard link of a group
+}
+
+// Plan is an ordered list of operations that makes the synch folder the same as the source folder
+type Plan struct {
+	Master string
+	Slave  string
+	Ops    []Operation
+	Synced []string         // paths of files found equal, they are saved in the state as synchronized
+	Errors map[string]error // entries that couldn't be read or compared, they are skipped until the next check
+
+	replica *Snapshot
+}
+
+// planner compares snapshots of the source and synch folders
+type planner struct {
+	mode      string
+	compare   Comparator
+	preserve  Preserve
+	symlinks  string
+	specials  string
+	hardLinks bool
+	state     *state.DB
+	trash     string // the trash folder is never deleted if it is inside the synch folder
+	env
+
+	deleteExcluded bool
+}
+
+// func returns a planner with the options of the job
+func newPlanner(opts Options, e env) *planner {
+
+	mode := opts.Compare
+
+	if _, ok := comparators[mode]; !ok {
+		mode = CompareSHA256
+	}
+
+	compare := comparators[mode](e.files())
+
+	// a comparator of the options finds any difference of content
+	if opts.Comparator != nil {
+		mode, compare = "", opts.Comparator
+	}
+
+	return &planner{
+		mode:      mode,
+		compare:   compare,
+		preserve:  opts.Preserve,
+		symlinks:  opts.Symlinks,
+		specials:  opts.Specials,
+		hardLinks: opts.HardLinks,
+		state:     opts.State,
+		trash:     trashRoot(opts.Trash),
+		env:       e,
+
+		deleteExcluded: opts.Filter != nil && opts.Filter.DeleteExcluded,
+	}
+}
+
+// func returns the operations that make slave the same as master. Deletions go first,
+// then folders are created parents first, then files are written and folder attributes go last.
+// An entry that can't be compared is skipped until the next plan. Files are not compared once ctx is done
+func (p *planner) plan(ctx context.Context, master, slave *Snapshot) *Plan {
+
+	plan := &Plan{Master: master.Root, Slave: slave.Root, Errors: map[string]error{}, replica: slave}
+
+	var deletes, creates, links, folderMeta []Operation
+
+	// a copy excluded only by its size or age is still the copy of a synchronized file
+	for path, entry := range slave.Excluded {
+
+		if _, ok := master.Entries[path]; ok {
+			slave.Entries[path] = entry
+			delete(slave.Excluded, path)
+		}
+	}
+
+	protected := p.protected(master, slave)
+
+	isTrash := p.trashOf(slave)
+
+	// entries of the synch folder that are missing in the source folder
+	for _, path := range slave.Paths() {
+
+		slEntry := slave.Entries[path]
+
+		// a source entry that couldn't be read may still exist
+		if path == "" || isTemp(slEntry.Info.Name()) || master.failed(path) || master.Errors[path] != nil || isTrash(path) {
+			continue
+		}
+
+		// content of a folder that is deleted goes with the folder. A folder with excluded
+		// entries is kept, only its other content is deleted
+		if dir := parent(path); dir != "" && !protected[dir] {
+
+			if msEntry, ok := master.Entries[dir]; !ok || !msEntry.Info.IsDir() {
+				continue
+			}
+		}
+
+		if _, ok := master.Entries[path]; ok || protected[path] {
+			continue
+		}
+
+		reason := ReasonExtra
+
+		if _, ok := master.Excluded[path]; ok {
+			reason = ReasonExcluded
+		}
+
+		deletes = append(deletes, deleteOp(path, slEntry, reason))
+	}
+
+	// excluded entries are deleted only on demand, their folders are checked above
+	for _, path := range excludedPaths(slave) {
+
+		if !p.deleteExcluded || master.failed(path) || isTrash(path) {
+			continue
+		}
+
+		if dir := parent(path); dir != "" {
+
+			if msEntry, ok := master.Entries[dir]; !ok || !msEntry.Info.IsDir() {
+				continue
+			}
+		}
+
+		deletes = append(deletes, deleteOp(path, slave.Excluded[path], ReasonExcluded))
+	}
+
+	// the first hard link of every group of the source folder and if it is copied
+	groups := map[fileKey]string{}
+	copied := map[string]bool{}
+
+	for _, path := range master.Paths() {
+
+		// files are not compared any more, the caller drops the plan
+		if ctx.Err() != nil {
+			break
+		}
+
+		msEntry := master.Entries[path]
+
+		if slave.failed(path) {
+			continue
+		}
+
+		slEntry, exists := slave.Entries[path]
+
+		msMode := msEntry.Info.Mode()
+
+		// an entry of another type is deleted before the new one is created
+		if exists && path != "" && !sameType(msEntry, slEntry) {
+			deletes = append(deletes, deleteOp(path, slEntry, ReasonType))
+			exists = false
+		}
+
+		switch {
+
+		case msMode.IsDir():
+
+			if !exists {
+				creates = append(creates, Operation{Type: OpMkdir, Path: path, Reason: ReasonMissing, Info: msEntry.Info})
+			}
+
+			if !p.preserve.enabled() {
+				continue
+			}
+
+			// attributes of a folder change when its content is written, so they go last, deepest first
+			equal := false
+
+			if exists {
+
+				var err error
+
+				equal, err = p.preserve.equal(p.files(), master.path(path), slave.path(path), msEntry.Info, slEntry.Info)
+
+				if err != nil {
+					p.send(logger.Error("plan", "attributes can't be compared").WithPath(slave.path(path)).WithErr(err))
+					plan.Errors[path] = err
+					continue
+				}
+			}
+
+			if !equal {
+				folderMeta = append([]Operation{{Type: OpUpdateMeta, Path: path, Reason: ReasonMeta, Info: msEntry.Info}}, folderMeta...)
+			}
+
+		case msMode.IsRegular():
+
+			if p.hardLinks {
+
+				key, count := linkKey(msEntry.Info)
+
+				if first, ok := groups[key]; ok && count > 1 {
+
+					// a new copy of the first link is a new file, so the link is made again
+					if !exists || !linked(slave.Entries[first], slEntry) || copied[first] {
+						links = append(links, Operation{Type: OpHardLink, Path: path, Reason: ReasonHardLink, Info: msEntry.Info, Target: first})
+					}
+
+					continue
+				}
+
+				if count > 1 {
+					groups[key] = path
+				}
+			}
+
+			op, synced, err := p.planFile(master, slave, path, exists)
+
+			if err != nil {
+				p.send(logger.Error("plan", "files can't be compared").WithPath(slave.path(path)).WithErr(err))
+				plan.Errors[path] = err
+				continue
+			}
+
+			if op != nil {
+				creates = append(creates, *op)
+				copied[path] = op.Type == OpCopyFile
+			}
+
+			if synced {
+				plan.Synced = append(plan.Synced, path)
+			}
+
+		case msMode&os.ModeSymlink != 0:
+
+			if p.symlinks == SymlinkSkip {
+				continue
+			}
+
+			if !exists || slEntry.Target != msEntry.Target {
+				creates = append(creates, Operation{Type: OpSymlink, Path: path, Reason: replaceReason(exists, ReasonTarget), Info: msEntry.Info, Target: msEntry.Target})
+			}
+
+		default:
+
+			if p.specials != SpecialRecreate {
+				continue
+			}
+
+			if !exists || !sameSpecial(msEntry.Info, slEntry.Info) {
+				creates = append(creates, Operation{Type: OpSpecial, Path: path, Reason: replaceReason(exists, ReasonType), Info: msEntry.Info})
+			}
+		}
+	}
+
+	plan.Ops = append(plan.Ops, deletes...)
+	plan.Ops = append(plan.Ops, creates...)
+	plan.Ops = append(plan.Ops, links...)
+	plan.Ops = append(plan.Ops, folderMeta...)
+
+	return plan
+}
+
+// func compares a source file with its copy and returns the operation that is needed, if any,
+// and true if the files are found equal
+func (p *planner) planFile(master, slave *Snapshot, path string, exists bool) (*Operation, bool, error) {
+
+	msInfo := master.Entries[path].Info
+
+	if !exists {
+		return &Operation{Type: OpCopyFile, Path: path, Reason: ReasonMissing, Info: msInfo}, false, nil
+	}
+
+	slInfo := slave.Entries[path].Info
+
+	// the state knows only size, time and mode, so it skips the content comparison but not the metadata one:
+	// a change of only the owner or xattrs of the source doesn't change them
+	synced := p.isSynced(master, slave, path)
+
+	if !synced {
+
+		equal, err := p.compare(master.path(path), slave.path(path), msInfo, slInfo)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !equal {
+			return &Operation{Type: OpCopyFile, Path: path, Reason: p.differReason(msInfo, slInfo), Info: msInfo}, false, nil
+		}
+	}
+
+	if p.preserve.enabled() {
+
+		equal, err := p.preserve.equal(p.files(), master.path(path), slave.path(path), msInfo, slInfo)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !equal {
+			return &Operation{Type: OpUpdateMeta, Path: path, Reason: ReasonMeta, Info: msInfo}, false, nil
+		}
+	}
+
+	return nil, !synced, nil
+}
+
+// func checks if both the source file and its copy are unchanged since they were synchronized last time
+func (p *planner) isSynced(master, slave *Snapshot, path string) bool {
+
+	msEntry, ok := master.Entries[path]
+
+	if !ok || p.state == nil {
+		return false
+	}
+
+	slEntry, ok := slave.Entries[path]
+
+	if !ok {
+		return false
+	}
+
+	return p.state.Unchanged(master.path(path), msEntry.Info) && p.state.Unchanged(slave.path(path), slEntry.Info)
+}
+
+// func returns why the copy is not equal to the source file
+func (p *planner) differReason(msInfo, slInfo os.FileInfo) string {
+
+	switch {
+
+	case msInfo.Size() != slInfo.Size():
+		return ReasonSize
+
+	case p.mode == CompareModTime:
+		return ReasonModTime
+
+	case p.mode == "":
+		return ReasonContent
+
+	default:
+		return ReasonHash
+	}
+}
+
+// func returns the entries of the synch folder that must not be deleted: entries excluded in either tree
+// and their parent folders. Nothing is protected if excluded entries are deleted
+func (p *planner) protected(master, slave *Snapshot) map[string]bool {
+
+	protected := map[string]bool{}
+
+	if p.deleteExcluded {
+		return protected
+	}
+
+	protect := func(path string) {
+
+		for ; path != "" && !protected[path]; path = parent(path) {
+			protected[path] = true
+		}
+	}
+
+	for path := range slave.Excluded {
+		protect(path)
+	}
+
+	for path := range master.Excluded {
+
+		if _, ok := slave.Entries[path]; ok {
+			protect(path)
+		}
+	}
+
+	return protected
+}
+
+// func returns the sorted paths of excluded entries of the snapshot
+func excludedPaths(s *Snapshot) []string {
+
+	paths := make([]string, 0, len(s.Excluded))
+
+	for path := range s.Excluded {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// func returns the root of the trash or "" if there is no trash
+func trashRoot(t *trash.Trash) string {
+
+	if t == nil {
+		return ""
+	}
+
+	return t.Root
+}
+
+// func returns a func that checks if an entry of the synch folder is the trash folder. The trash root is absolute,
+// the synch folder may be relative or end with a slash, so both are compared as clean absolute paths
+func (p *planner) trashOf(slave *Snapshot) func(path string) bool {
+
+	root, err := filepath.Abs(slave.Root)
+
+	if p.trash == "" || err != nil {
+		return func(string) bool { return false }
+	}
+
+	return func(path string) bool {
+		return filepath.Join(root, filepath.FromSlash(path)) == p.trash
+	}
+}
+
+// func returns the absolute path of an entry of the snapshot
+func (s *Snapshot) path(path string) string {
+
+	if path == "" {
+		return s.Root
+	}
+
+	return s.Root + "/" + path
+}
+
+// func returns the operation that deletes the entry of the synch folder
+func deleteOp(path string, entry Entry, reason string) Operation {
+
+	if entry.Info.IsDir() {
+		return Operation{Type: OpDeleteDir, Path: path, Reason: reason}
+	}
+
+	return Operation{Type: OpDeleteFile, Path: path, Reason: reason}
+}
+
+// func checks if two entries are of the same type, so one can be updated to the other
+func sameType(a, b Entry) bool {
+
+	return a.Info.Mode().Type() == b.Info.Mode().Type()
+}
+
+// func checks if two entries of the synch folder are the same file
+func linked(a, b Entry) bool {
+
+	return a.Info != nil && b.Info != nil && os.SameFile(a.Info, b.Info)
+}
+
+// func returns ReasonMissing for a new entry and reason for an existing one
+func replaceReason(exists bool, reason string) string {
+
+	if !exists {
+		return ReasonMissing
+	}
+
+	return reason
+}
+
+// func writes the operations one per line and the number of operations of every type
+func (p *Plan) Write(w io.Writer) error {
+
+	count := map[string]int{}
+
+	for _, op := range p.Ops {
+
+		count[op.Type]++
+
+		_, err := fmt.Fprintf(w, "%-7s %s (%s)\n", op.Type, p.Slave+"/"+op.Path, op.Reason)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	summary := fmt.Sprintf("%d operations", len(p.Ops))
+
+	for _, opType := range []string{OpDeleteFile, OpDeleteDir, OpMkdir, OpCopyFile, OpSymlink, OpSpecial, OpHardLink, OpUpdateMeta} {
+
+		if count[opType] > 0 {
+			summary += fmt.Sprintf(", %d %s", count[opType], opType)
+		}
+	}
+
+	_, err := fmt.Fprintln(w, summary)
+
+	return err
+}
+
+// func returns the sorted paths of entries that couldn't be read or compared
+func (p *Plan) ErrorPaths() []string {
+
+	paths := make([]string, 0, len(p.Errors))
+
+	for path := range p.Errors {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
@@ -0,0 +1,183 @@
+package synch
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fileInfo is os.FileInfo of an entry that doesn't exist on disk
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+func TestPlan(t *testing.T) {
+
+	req := require.New(t)
+
+	now := time.Now()
+
+	file := func(name string, size int64, modTime time.Time) Entry {
+		return Entry{Info: fileInfo{name: name, size: size, mode: 0644, modTime: modTime}}
+	}
+
+	dir := func(name string) Entry {
+		return Entry{Info: fileInfo{name: name, mode: os.ModeDir | 0755}}
+	}
+
+	link := func(name, target string) Entry {
+		return Entry{Info: fileInfo{name: name, mode: os.ModeSymlink | 0777}, Target: target}
+	}
+
+	master := &Snapshot{Root: "/master", Entries: map[string]Entry{
+		"":            dir("master"),
+		"new":         dir("new"),
+		"new/file1":   file("file1", 4, now),
+		"missing":     file("missing", 4, now),
+		"size":        file("size", 4, now),
+		"newer":       file("newer", 4, now),
+		"same":        file("same", 4, now),
+		"conflict":    dir("conflict"),
+		"link":        link("link", "same"),
+		"failed/file": file("file", 4, now),
+	}}
+
+	// a temporary file of an interrupted copy is never deleted by the plan
+	tempCopy := "copy-0123456789abcdef"
+
+	slave := &Snapshot{Root: "/slave", Entries: map[string]Entry{
+		"":                    dir("slave"),
+		"size":                file("size", 5, now),
+		"newer":               file("newer", 4, now.Add(-time.Minute)),
+		"same":                file("same", 4, now),
+		"conflict":            file("conflict", 4, now),
+		"link":                link("link", "size"),
+		"extra":               dir("extra"),
+		"extra/sub":           dir("sub"),
+		"extra/sub/file2":     file("file2", 4, now),
+		"deleted":             file("deleted", 4, now),
+		TempPrefix + tempCopy: file(TempPrefix+tempCopy, 4, now),
+	}, Failed: map[string]error{"failed": os.ErrPermission}}
+
+	p := &planner{mode: CompareModTime, compare: compareModTime, symlinks: SymlinkCopy, specials: SpecialSkip}
+
+	plan := p.plan(context.Background(), master, slave)
+
+	ops := []Operation{}
+
+	for _, op := range plan.Ops {
+		ops = append(ops, Operation{Type: op.Type, Path: op.Path, Reason: op.Reason})
+	}
+
+	req.Equal([]Operation{
+		{Type: OpDeleteFile, Path: "deleted", Reason: ReasonExtra},
+		{Type: OpDeleteDir, Path: "extra", Reason: ReasonExtra},
+		{Type: OpDeleteFile, Path: "conflict", Reason: ReasonType},
+		{Type: OpMkdir, Path: "conflict", Reason: ReasonMissing},
+		{Type: OpSymlink, Path: "link", Reason: ReasonTarget},
+		{Type: OpCopyFile, Path: "missing", Reason: ReasonMissing},
+		{Type: OpMkdir, Path: "new", Reason: ReasonMissing},
+		{Type: OpCopyFile, Path: "new/file1", Reason: ReasonMissing},
+		{Type: OpCopyFile, Path: "newer", Reason: ReasonModTime},
+		{Type: OpCopyFile, Path: "size", Reason: ReasonSize},
+	}, ops)
+
+	req.Equal([]string{"same"}, plan.Synced)
+	req.Equal("same", plan.Ops[4].Target)
+
+}
+
+func TestDryRun(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { CompareMode = CompareSHA256 }()
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.MkdirAll(masterPath+"/new/sub", 0755))
+	req.NoError(os.WriteFile(masterPath+"/new/sub/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/missing", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/size", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/hash", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/same", []byte("test"), 0644))
+
+	req.NoError(os.MkdirAll(slavePath+"/extra/sub", 0755))
+	req.NoError(os.WriteFile(slavePath+"/extra/sub/file2", []byte("test"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/size", []byte("test!"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/hash", []byte("tset"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/same", []byte("test"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/deleted", []byte("test"), 0644))
+
+	plan, err := DryRun(masterPath, slavePath)
+	req.NoError(err)
+
+	ops := []Operation{}
+
+	for _, op := range plan.Ops {
+		ops = append(ops, Operation{Type: op.Type, Path: op.Path, Reason: op.Reason})
+	}
+
+	req.Equal([]Operation{
+		{Type: OpDeleteFile, Path: "deleted", Reason: ReasonExtra},
+		{Type: OpDeleteDir, Path: "extra", Reason: ReasonExtra},
+		{Type: OpCopyFile, Path: "hash", Reason: ReasonHash},
+		{Type: OpCopyFile, Path: "missing", Reason: ReasonMissing},
+		{Type: OpMkdir, Path: "new", Reason: ReasonMissing},
+		{Type: OpMkdir, Path: "new/sub", Reason: ReasonMissing},
+		{Type: OpCopyFile, Path: "new/sub/file1", Reason: ReasonMissing},
+		{Type: OpCopyFile, Path: "size", Reason: ReasonSize},
+	}, ops)
+
+	// nothing is changed
+	folder, err := os.ReadDir(slavePath)
+	req.NoError(err)
+	req.Len(folder, 5)
+
+	data, err := os.ReadFile(slavePath + "/hash")
+	req.NoError(err)
+	req.Equal("tset", string(data))
+
+	// the same files with the size compare mode
+	CompareMode = CompareSize
+
+	plan, err = DryRun(masterPath, slavePath)
+	req.NoError(err)
+	req.Len(plan.Ops, 7)
+
+}
+
+func TestPlanWrite(t *testing.T) {
+
+	req := require.New(t)
+
+	plan := &Plan{Slave: "/slave", Ops: []Operation{
+		{Type: OpDeleteDir, Path: "dir", Reason: ReasonExtra},
+		{Type: OpCopyFile, Path: "file1", Reason: ReasonMissing},
+		{Type: OpCopyFile, Path: "file2", Reason: ReasonHash},
+	}}
+
+	var buf bytes.Buffer
+
+	req.NoError(plan.Write(&buf))
+	req.Equal("RMDIR   /slave/dir (extra in replica)\n"+
+		"COPY    /slave/file1 (missing in replica)\n"+
+		"COPY    /slave/file2 (hash differs)\n"+
+		"3 operations, 1 RMDIR, 2 COPY\n", buf.String())
+
+}
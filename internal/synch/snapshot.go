@@ -0,0 +1,343 @@
+package synch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Entry is a file, folder, link or special file found in a folder tree
+type Entry struct {
+	Info   os.FileInfo // info of the entry itself, or of the file a followed symlink points to
+	Target string      // target of a symlink that is not followed
+}
+
+// Snapshot is the state of a folder tree at the moment it was scanned
+type Snapshot struct {
+	Root     string
+	Entries  map[string]Entry // entries by path relative to Root, Root itself is ""
+	Failed   map[string]error // folders that couldn't be read, nothing is known about their content
+	Excluded map[string]Entry // entries excluded by the filter, excluded folders are not read
+	Errors   map[string]error // entries and folders that couldn't be read, they are skipped
+
+	fs FS
+}
+
+// func returns the sorted paths of the snapshot, every folder goes before its content
+func (s *Snapshot) Paths() []string {
+
+	paths := make([]string, 0, len(s.Entries))
+
+	for path := range s.Entries {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// func returns the sorted paths of entries that couldn't be read
+func (s *Snapshot) errorPaths() []string {
+
+	paths := make([]string, 0, len(s.Errors))
+
+	for path := range s.Errors {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// func checks if path is in a folder that couldn't be read
+func (s *Snapshot) failed(path string) bool {
+
+	for path != "" {
+
+		path = parent(path)
+
+		if _, ok := s.Failed[path]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// func reads the whole tree under root. Symlinks are followed if follow is set.
+// An error is returned only if root itself can't be read
+func Scan(root string, follow bool) (*Snapshot, error) {
+
+	return scanFolders(context.Background(), OS, root, []string{""}, true, follow, nil, MetaWorkers)
+}
+
+// func reads the given folders of the tree under root of fsys. Subfolders are read only if recursive is set,
+// at most workers of them at the same time. A folder that doesn't exist or is excluded by the matcher is skipped.
+// Folders are not read any more once ctx is done, then its error is returned
+func scanFolders(ctx context.Context, fsys FS, root string, folders []string, recursive, follow bool, m *matcher, workers int) (*Snapshot, error) {
+
+	snapshot := &Snapshot{
+		Root:     root,
+		Entries:  map[string]Entry{},
+		Failed:   map[string]error{},
+		Excluded: map[string]Entry{},
+		Errors:   map[string]error{},
+		fs:       fsys,
+	}
+
+	info, err := fsys.Stat(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.Entries[""] = Entry{Info: info}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	// the current goroutine is one of the workers
+	w := &walk{ctx: ctx, s: snapshot, recursive: recursive, follow: follow, m: m, slots: make(chan struct{}, workers-1)}
+
+	defer w.wg.Wait()
+
+	for _, folder := range folders {
+
+		info, err := fsys.Stat(filepath.Join(root, folder))
+
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		if m.excludedFolder(folder, info) {
+			w.add(func() { snapshot.Excluded[folder] = Entry{Info: info} })
+			continue
+		}
+
+		if folder != "" {
+			w.add(func() { snapshot.Entries[folder] = Entry{Info: info} })
+		}
+
+		err = w.scan(folder, nil)
+
+		if err != nil && folder == "" {
+			return nil, err
+		}
+	}
+
+	w.wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// walk reads folders of a snapshot. Subfolders are read by other goroutines while
+// there are free slots, otherwise by the goroutine that found them
+type walk struct {
+	ctx       context.Context
+	s         *Snapshot
+	recursive bool
+	follow    bool
+	m         *matcher
+	slots     chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex // guards the maps of the snapshot
+}
+
+// func changes the snapshot
+func (w *walk) add(change func()) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	change()
+}
+
+// func reads the folder once and adds its entries to the snapshot. parents are the folders
+// above it, they are used to find loops of followed symlinks. Entries excluded by the matcher are put aside.
+// Entries that can't be read are put into the errors. Nothing is read once the context of the walk is done
+func (w *walk) scan(folder string, parents []os.FileInfo) error {
+
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	s := w.s
+
+	path := filepath.Join(s.Root, folder)
+
+	entries, err := s.fs.ReadDir(path)
+
+	if err != nil {
+
+		w.add(func() {
+			s.Failed[folder] = err
+			s.Errors[folder] = err
+		})
+
+		return err
+	}
+
+	if w.follow {
+
+		if info, err := s.fs.Stat(path); err == nil {
+			parents = append(parents[:len(parents):len(parents)], info)
+		}
+	}
+
+	// entries are collected first, so the snapshot is locked once for the folder
+	found := map[string]Entry{}
+	excluded := map[string]Entry{}
+	errs := map[string]error{}
+	subfolders := []string{}
+
+	for _, entry := range entries {
+
+		rel := join(folder, entry.Name())
+
+		info, err := entry.Info()
+
+		if err != nil {
+
+			// the entry is removed after the folder was read
+			if !errors.Is(err, os.ErrNotExist) {
+				errs[rel] = err
+			}
+
+			continue
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+
+			if !w.follow {
+
+				target, err := s.fs.Readlink(filepath.Join(path, entry.Name()))
+
+				if err != nil {
+					errs[rel] = err
+					continue
+				}
+
+				if w.m.excluded(rel, info) {
+					excluded[rel] = Entry{Info: info, Target: target}
+					continue
+				}
+
+				found[rel] = Entry{Info: info, Target: target}
+
+				continue
+			}
+
+			info, err = s.fs.Stat(filepath.Join(path, entry.Name()))
+
+			if err != nil {
+				errs[rel] = err
+				continue
+			}
+
+			if isLoop(info, parents) {
+				errs[rel] = errors.New("symlink loop: " + filepath.Join(path, entry.Name()) + " points to its parent folder")
+				continue
+			}
+		}
+
+		if w.m.excluded(rel, info) {
+			excluded[rel] = Entry{Info: info}
+			continue
+		}
+
+		found[rel] = Entry{Info: info}
+
+		if info.IsDir() && w.recursive {
+			subfolders = append(subfolders, rel)
+		}
+	}
+
+	w.add(func() {
+
+		for rel, entry := range found {
+			s.Entries[rel] = entry
+		}
+
+		for rel, entry := range excluded {
+			s.Excluded[rel] = entry
+		}
+
+		for rel, err := range errs {
+			s.Errors[rel] = err
+		}
+	})
+
+	for _, rel := range subfolders {
+
+		select {
+
+		case w.slots <- struct{}{}:
+
+			w.wg.Add(1)
+
+			go func(rel string) {
+
+				defer w.wg.Done()
+
+				_ = w.scan(rel, parents)
+
+				<-w.slots
+
+			}(rel)
+
+		default:
+			_ = w.scan(rel, parents)
+		}
+	}
+
+	return nil
+}
+
+// func checks if the folder is one of parents
+func isLoop(info os.FileInfo, parents []os.FileInfo) bool {
+
+	if !info.IsDir() {
+		return false
+	}
+
+	for _, parent := range parents {
+
+		if os.SameFile(parent, info) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// func joins a path relative to the root with an entry name
+func join(folder, name string) string {
+
+	if folder == "" {
+		return name
+	}
+
+	return folder + "/" + name
+}
+
+// func returns the parent of a path relative to the root
+func parent(path string) string {
+
+	dir := filepath.Dir(path)
+
+	if dir == "." {
+		return ""
+	}
+
+	return dir
+}
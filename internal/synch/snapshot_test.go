@@ -0,0 +1,161 @@
+package synch
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+
+	req := require.New(t)
+
+	root := t.TempDir()
+
+	req.NoError(os.MkdirAll(root+"/a/b", 0755))
+	req.NoError(os.WriteFile(root+"/a/b/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(root+"/file2", []byte("test"), 0644))
+	req.NoError(os.Symlink("a", root+"/link"))
+	req.NoError(os.Symlink("..", root+"/a/loop"))
+
+	cases := map[string]struct {
+		follow bool
+		paths  []string
+	}{
+		"links are kept": {
+			paths: []string{"", "a", "a/b", "a/b/file1", "a/loop", "file2", "link"},
+		},
+
+		"links are followed": {
+			follow: true,
+			paths:  []string{"", "a", "a/b", "a/b/file1", "file2", "link", "link/b", "link/b/file1"},
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			snapshot, err := Scan(root, cs.follow)
+			req.NoError(err)
+			req.Equal(cs.paths, snapshot.Paths())
+
+			if !cs.follow {
+				req.Equal("a", snapshot.Entries["link"].Target)
+			}
+		})
+	}
+
+	snapshot, err := scanFolders(context.Background(), OS, root, []string{"a"}, false, false, nil, 1)
+	req.NoError(err)
+	req.Equal([]string{"", "a", "a/b", "a/loop"}, snapshot.Paths())
+
+	_, err = Scan(root+"/wrong", false)
+	req.ErrorIs(err, os.ErrNotExist)
+
+}
+
+func TestScanParallel(t *testing.T) {
+
+	req := require.New(t)
+
+	root := t.TempDir()
+
+	folders := 1
+
+	for a := 0; a < 10; a++ {
+		for b := 0; b < 5; b++ {
+
+			folder := root + "/a" + strconv.Itoa(a) + "/b" + strconv.Itoa(b)
+
+			req.NoError(os.MkdirAll(folder, 0755))
+			req.NoError(os.WriteFile(folder+"/file", []byte("test"), 0644))
+			req.NoError(os.Symlink("file", folder+"/link"))
+
+			folders++
+		}
+
+		folders++
+	}
+
+	serial, err := scanFolders(context.Background(), OS, root, []string{""}, true, false, nil, 1)
+	req.NoError(err)
+	req.Len(serial.Entries, folders+100)
+
+	fsys := &testFS{FS: OS}
+
+	parallel, err := scanFolders(context.Background(), fsys, root, []string{""}, true, false, nil, 8)
+	req.NoError(err)
+
+	// every folder is read exactly once
+	req.Equal(folders, fsys.reads)
+	req.Equal(serial.Paths(), parallel.Paths())
+	req.Equal("file", parallel.Entries["a9/b4/link"].Target)
+
+}
+
+// file entries of one folder are found by their names: the folder is read once, not once for every file
+func BenchmarkScan(b *testing.B) {
+
+	masterPath := b.TempDir()
+	slavePath := b.TempDir()
+
+	for n := 0; n < 10000; n++ {
+
+		name := "/file" + strconv.Itoa(n)
+
+		if err := os.WriteFile(masterPath+name, []byte("test"), 0644); err != nil {
+			b.Fatal(err)
+		}
+
+		// a half of the files are already copied
+		if n%2 == 0 {
+			if err := os.WriteFile(slavePath+name, []byte("test"), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	// the same files in 100 folders are read by several workers
+	treePath := b.TempDir()
+	makeTree(b, treePath, 100, 100, 4)
+
+	cases := []struct {
+		name    string
+		master  string
+		slave   string
+		workers int
+	}{
+		{"folder=10000/workers=1", masterPath, slavePath, 1},
+		{"tree=100x100/workers=1", treePath, slavePath, 1},
+		{"tree=100x100/workers=8", treePath, slavePath, 8},
+		{"tree=100x100/workers=32", treePath, slavePath, 32},
+	}
+
+	for _, cs := range cases {
+
+		b.Run(cs.name, func(b *testing.B) {
+
+			fsys := &testFS{FS: OS}
+
+			job := &Job{Master: cs.master, Slave: cs.slave, Options: Options{
+				FS:          fsys,
+				Logger:      Discard,
+				Compare:     CompareSize,
+				MetaWorkers: cs.workers,
+			}}
+
+			for i := 0; i < b.N; i++ {
+
+				if _, err := job.DryRun(); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(fsys.reads)/float64(b.N), "readdirs/op")
+		})
+	}
+
+}
@@ -0,0 +1,78 @@
+package synch
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Summary counts what a check has done
+type Summary struct {
+	Copied   int   // files copied to the synch folder
+	Bytes    int64 // size of the copied files
+	Created  int   // folders, links and special files created
+	Updated  int   // entries with updated attributes
+	Deleted  int   // files and folders deleted or moved to the trash
+	Errors   int   // failed operations and checks that couldn't be made
+	Duration time.Duration
+}
+
+// func counts the results of executed operations. Failed operations are counted only as errors
+func Summarize(results []Result) Summary {
+
+	var s Summary
+
+	for _, result := range results {
+
+		if result.Err != nil {
+			s.Errors++
+			continue
+		}
+
+		switch result.Op.Type {
+
+		case OpCopyFile:
+
+			s.Copied++
+
+			if result.Op.Info != nil {
+				s.Bytes += result.Op.Info.Size()
+			}
+
+		case OpMkdir, OpSymlink, OpSpecial, OpHardLink:
+			s.Created++
+
+		case OpUpdateMeta:
+			s.Updated++
+
+		case OpDeleteFile, OpDeleteDir:
+			s.Deleted++
+		}
+	}
+
+	return s
+}
+
+// func adds the counts of other to the summary. The longest duration is kept, as jobs run at the same time
+func (s *Summary) Add(other Summary) {
+
+	s.Copied += other.Copied
+	s.Bytes += other.Bytes
+	s.Created += other.Created
+	s.Updated += other.Updated
+	s.Deleted += other.Deleted
+	s.Errors += other.Errors
+
+	if other.Duration > s.Duration {
+		s.Duration = other.Duration
+	}
+}
+
+// func writes the summary in one line
+func (s Summary) Write(w io.Writer) error {
+
+	_, err := fmt.Fprintf(w, "%d files copied, %d bytes, %d created, %d updated, %d deleted, %d errors in %s\n",
+		s.Copied, s.Bytes, s.Created, s.Updated, s.Deleted, s.Errors, s.Duration.Round(time.Millisecond))
+
+	return err
+}
@@ -0,0 +1,42 @@
+package synch
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+
+	req := require.New(t)
+
+	results := []Result{
+		{Op: Operation{Type: OpDeleteFile, Path: "old"}},
+		{Op: Operation{Type: OpDeleteDir, Path: "dir"}, Err: errors.New("permission denied")},
+		{Op: Operation{Type: OpMkdir, Path: "new"}},
+		{Op: Operation{Type: OpCopyFile, Path: "new/file1", Info: fileInfo{name: "file1", size: 100}}},
+		{Op: Operation{Type: OpCopyFile, Path: "new/file2", Info: fileInfo{name: "file2", size: 20}}},
+		{Op: Operation{Type: OpCopyFile, Path: "new/file3", Info: fileInfo{name: "file3", size: 5}}, Err: errors.New("no space left")},
+		{Op: Operation{Type: OpSymlink, Path: "new/link"}},
+		{Op: Operation{Type: OpUpdateMeta, Path: "new"}},
+	}
+
+	summary := Summarize(results)
+	summary.Duration = 1500 * time.Millisecond
+
+	req.Equal(Summary{Copied: 2, Bytes: 120, Created: 2, Updated: 1, Deleted: 1, Errors: 2, Duration: 1500 * time.Millisecond}, summary)
+
+	total := Summary{Copied: 1, Bytes: 10, Errors: 1, Duration: 2 * time.Second}
+	total.Add(summary)
+
+	req.Equal(Summary{Copied: 3, Bytes: 130, Created: 2, Updated: 1, Deleted: 1, Errors: 3, Duration: 2 * time.Second}, total)
+
+	var buf bytes.Buffer
+
+	req.NoError(summary.Write(&buf))
+	req.Equal("2 files copied, 120 bytes, 2 created, 1 updated, 1 deleted, 2 errors in 1.5s\n", buf.String())
+
+}
@@ -0,0 +1,108 @@
+package synch
+
+import (
+	"context"
+	"synchfolder/internal/logger"
+)
+
+// Logger receives the log messages of a job
+type Logger interface {
+	Log(message logger.LogMessage)
+}
+
+// LoggerFunc is a func that receives log messages
+type LoggerFunc func(message logger.LogMessage)
+
+func (f LoggerFunc) Log(message logger.LogMessage) {
+
+	f(message)
+}
+
+// Discard is a logger that drops all messages
+var Discard Logger = LoggerFunc(func(logger.LogMessage) {})
+
+// Syncer keeps a synch folder the same as a source folder. Unlike the functions of the package it
+// doesn't use the package settings, CriticalChan or the logger of the app: everything is set by its options,
+// messages go to the logger of the options and errors are returned
+type Syncer struct {
+	job Job
+}
+
+// SyncResult is the outcome of a check
+type SyncResult struct {
+	Plan    *Plan
+	Results []Result         // executed operations in the plan order
+	Errors  map[string]error // failed operations, entries that couldn't be read or compared, by path relative to the folders
+	Summary Summary
+}
+
+// func returns a syncer of source and dest folders. Options that are not set are defaults:
+// OS file system, SHA256 comparison, no logger, all entries and one worker
+func NewSyncer(source, dest string, opts Options) *Syncer {
+
+	if opts.FS == nil {
+		opts.FS = OS
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = Discard
+	}
+
+	// critical errors are returned, nobody waits for the signal
+	return &Syncer{job: Job{Master: source, Slave: dest, Options: opts, Critical: make(chan struct{}, 1)}}
+}
+
+// func synchronizes the folders once. The error is returned if the check can't be made or is stopped by ctx,
+// then the result has the operations that were done before. Failed operations don't stop the others,
+// they are in the errors of the result
+func (s *Syncer) Sync(ctx context.Context) (*SyncResult, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	plan, err := s.job.planFolders(ctx, []string{""}, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.job.Breaker.check(plan, true, s.job.environment()); err != nil {
+		return nil, err
+	}
+
+	return newSyncResult(plan, newExecutor(&s.job).execute(ctx, plan)), ctx.Err()
+}
+
+// func returns the outcome of the executed plan. Entries that couldn't be read or compared are counted as errors
+func newSyncResult(plan *Plan, results []Result) *SyncResult {
+
+	result := &SyncResult{Plan: plan, Results: results, Errors: map[string]error{}}
+
+	for path, err := range plan.Errors {
+		result.Errors[path] = err
+	}
+
+	result.Summary = Summarize(results)
+
+	for _, r := range results {
+
+		if r.Err != nil {
+			result.Errors[r.Op.Path] = r.Err
+		}
+	}
+
+	result.Summary.Errors += len(plan.Errors)
+
+	return result
+}
+
+// func returns the operations that Sync would make without changing anything
+func (s *Syncer) DryRun(ctx context.Context) (*Plan, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.job.planFolders(ctx, []string{""}, true)
+}
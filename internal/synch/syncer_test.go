@@ -0,0 +1,224 @@
+package synch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"synchfolder/internal/logger"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testFS is the file system of the system that counts calls and fails to open chosen files
+type testFS struct {
+	FS
+
+	mu      sync.Mutex
+	reads   int
+	creates int
+	fail    map[string]error // errors of Open by base name
+	read    func()           // called when a folder is read
+}
+
+func (f *testFS) ReadDir(name string) ([]os.DirEntry, error) {
+
+	f.mu.Lock()
+	f.reads++
+	f.mu.Unlock()
+
+	if f.read != nil {
+		f.read()
+	}
+
+	return f.FS.ReadDir(name)
+}
+
+func (f *testFS) Open(name string) (io.ReadCloser, error) {
+
+	if err, ok := f.fail[filepath.Base(name)]; ok {
+		return nil, err
+	}
+
+	return f.FS.Open(name)
+}
+
+func (f *testFS) Create(name string, perm os.FileMode) (File, error) {
+
+	f.mu.Lock()
+	f.creates++
+	f.mu.Unlock()
+
+	return f.FS.Create(name, perm)
+}
+
+func TestSyncer(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.MkdirAll(masterPath+"/dir", 0755))
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/dir/file2", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/broken", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/skip.tmp", []byte("test"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/extra", []byte("test"), 0644))
+
+	denied := errors.New("access denied")
+	fsys := &testFS{FS: OS, fail: map[string]error{"broken": denied}}
+
+	var mu sync.Mutex
+	var messages []logger.LogMessage
+
+	compared := 0
+
+	s := NewSyncer(masterPath, slavePath, Options{
+		FS: fsys,
+		Logger: LoggerFunc(func(message logger.LogMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			messages = append(messages, message)
+		}),
+		Comparator: func(masterFile, slaveFile string, msInfo, slInfo os.FileInfo) (bool, error) {
+			compared++
+			return msInfo.Size() == slInfo.Size(), nil
+		},
+		Filter:  &Filter{Exclude: []string{"*.tmp"}},
+		Workers: 4,
+	})
+
+	result, err := s.Sync(context.Background())
+	req.NoError(err)
+
+	// a failed copy doesn't stop the others and is reported by its path
+	req.Equal(map[string]error{"broken": denied}, result.Errors)
+	req.Equal(Summary{Copied: 2, Bytes: 8, Created: 1, Deleted: 1, Errors: 1}, result.Summary)
+
+	for _, path := range []string{"file1", "dir/file2"} {
+		data, err := os.ReadFile(slavePath + "/" + path)
+		req.NoError(err)
+		req.Equal("test", string(data))
+	}
+
+	_, err = os.Stat(slavePath + "/skip.tmp")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	_, err = os.Stat(slavePath + "/extra")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	// files are read and written by the file system of the options
+	req.Equal(3, fsys.reads)
+	req.Equal(2, fsys.creates)
+
+	req.NotEmpty(messages)
+
+	fields := 0
+
+	for _, message := range messages {
+
+		req.NotEqual(logger.LogCritical, message.LogType)
+
+		// operations are logged with their fields
+		switch message.Path {
+
+		case slavePath + "/file1":
+			req.Equal(OpCopyFile, message.Op)
+			req.Equal(int64(4), message.Bytes)
+			req.False(message.Time.IsZero())
+			fields++
+
+		case slavePath + "/broken":
+			req.Equal(logger.LogError, message.LogType)
+			req.ErrorIs(message.Err, denied)
+			fields++
+		}
+	}
+
+	req.Equal(2, fields)
+
+	// files of the first check are compared by the comparator of the options
+	delete(fsys.fail, "broken")
+
+	result, err = s.Sync(context.Background())
+	req.NoError(err)
+	req.Empty(result.Errors)
+	req.Equal(1, result.Summary.Copied)
+	req.Equal(2, compared)
+
+	plan, err := s.DryRun(context.Background())
+	req.NoError(err)
+	req.Empty(plan.Ops)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err = s.Sync(ctx)
+	req.ErrorIs(err, context.Canceled)
+	req.Nil(result)
+
+	// a missing folder is an error of the check, not of a path
+	_, err = NewSyncer(masterPath+"/missing", slavePath, Options{}).Sync(context.Background())
+	req.ErrorIs(err, os.ErrNotExist)
+
+}
+
+func TestSyncerStop(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	for _, dir := range []string{"a", "b", "c"} {
+		req.NoError(os.MkdirAll(masterPath+"/"+dir, 0755))
+		req.NoError(os.MkdirAll(slavePath+"/"+dir, 0755))
+		req.NoError(os.WriteFile(masterPath+"/"+dir+"/file", []byte("test"), 0644))
+		req.NoError(os.WriteFile(slavePath+"/"+dir+"/file", []byte("old!"), 0644))
+	}
+
+	// the check is stopped while the trees are read: subfolders are not read any more
+	ctx, cancel := context.WithCancel(context.Background())
+
+	fsys := &testFS{FS: OS, read: cancel}
+
+	result, err := NewSyncer(masterPath, slavePath, Options{FS: fsys, Workers: 1}).Sync(ctx)
+	req.ErrorIs(err, context.Canceled)
+	req.Nil(result)
+	req.LessOrEqual(fsys.reads, 2)
+
+	// the check is stopped while the files are compared: the other files are not compared
+	ctx, cancel = context.WithCancel(context.Background())
+
+	compared := 0
+
+	s := NewSyncer(masterPath, slavePath, Options{
+		Comparator: func(masterFile, slaveFile string, msInfo, slInfo os.FileInfo) (bool, error) {
+			compared++
+			cancel()
+			return false, nil
+		},
+	})
+
+	result, err = s.Sync(ctx)
+	req.ErrorIs(err, context.Canceled)
+	req.Nil(result)
+	req.Equal(1, compared)
+
+	// nothing is copied by a stopped check
+	for _, dir := range []string{"a", "b", "c"} {
+		data, err := os.ReadFile(slavePath + "/" + dir + "/file")
+		req.NoError(err)
+		req.Equal("old!", string(data))
+	}
+
+	plan, err := s.DryRun(context.Background())
+	req.NoError(err)
+	req.Len(plan.Ops, 3)
+
+}
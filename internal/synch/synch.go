@@ -1,383 +1,394 @@
-package synch
-
-import (
-	"errors"
-	"io"
-	"os"
-	"sync"
-	"synchfolder/internal/logger"
-)
-
-var CriticalChan chan struct{}
-
-func init() {
-
-	CriticalChan = make(chan struct{}, 2)
-}
-
-// func that check master folder and run a goroutine for every file in the folder.
-// If it finds a subfolder it runs itself for subfolder
-func CheckMasterFolder(masterPath, slavePath string) error {
-
-	var logCritical logger.LogMessage = logger.LogMessage{LogType: logger.LogCritical, Ref: "CheckMasterFolder", Message: ""}
-
-	folder, err := os.ReadDir(masterPath)
-
-	if err != nil {
-		logCritical.Message = "error reading master folder: " + err.Error()
-		logger.LogChan <- logCritical
-		CriticalChan <- struct{}{}
-		return err
-	}
-
-	var wgCMF sync.WaitGroup
-
-	for _, entry := range folder {
-
-		if entry.IsDir() {
-
-			dirInfo, _ := entry.Info()
-
-			err = checkFolder(entry.Name(), slavePath, dirInfo.Mode().Perm())
-
-			if err == nil {
-				_ = CheckMasterFolder(masterPath+"/"+entry.Name(), slavePath+"/"+entry.Name())
-			}
-
-		} else {
-
-			wgCMF.Add(1)
-			go func() {
-
-				defer wgCMF.Done()
-				_ = checkFile(entry, masterPath, slavePath)
-
-			}()
-		}
-
-	}
-
-	wgCMF.Wait()
-
-	return nil
-
-}
-
-// func check if the file exists in the slave folder. If not - copy file from source folder
-func checkFile(entry os.DirEntry, masterPath string, slavePath string) error {
-
-	var logError logger.LogMessage = logger.LogMessage{LogType: logger.LogError, Ref: "checkFile", Message: ""}
-
-	if entry.IsDir() {
-		return errors.New("not a file")
-	}
-
-	folder, err := os.ReadDir(slavePath)
-
-	if err != nil {
-		logError.Message = err.Error()
-		logger.LogChan <- logError
-		return err
-
-	}
-
-	exist := false
-
-	for _, slEntry := range folder {
-
-		if slEntry.Name() == entry.Name() {
-
-			exist = true
-
-			msFileInfo, _ := entry.Info()
-			slFileInfo, _ := slEntry.Info()
-
-			if msFileInfo.Size() == slFileInfo.Size() {
-				return nil
-
-			} else {
-				err := os.Remove(slavePath + "/" + slFileInfo.Name())
-
-				if err != nil {
-
-					logError.Message = err.Error()
-					logger.LogChan <- logError
-					return err
-
-				}
-
-				err = copyFile(masterPath+"/"+msFileInfo.Name(), slavePath+"/"+slFileInfo.Name())
-
-				if err != nil {
-
-					logError.Message = err.Error()
-					logger.LogChan <- logError
-
-				}
-
-			}
-		}
-	}
-
-	if !exist {
-
-		err = copyFile(masterPath+"/"+entry.Name(), slavePath+"/"+entry.Name())
-
-		if err != nil {
-
-			logError.Message = err.Error()
-			logger.LogChan <- logError
-
-		}
-	}
-
-	return nil
-
-}
-
-// func that copy file from inPath to outPath
-func copyFile(inPath, outPath string) error {
-
-	var logInfo logger.LogMessage = logger.LogMessage{LogType: logger.LogInfo, Ref: "copyFile", Message: ""}
-
-	in, err := os.Open(inPath)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-
-	out, err := os.Create(outPath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, in)
-	if err != nil {
-		return err
-	}
-
-	logInfo.Message = "Copy file " + inPath + " to " + outPath
-	logger.LogChan <- logInfo
-
-	return nil
-}
-
-// func check if a folder exists in slave folder. If not, create the folder in slave
-func checkFolder(name, slavePath string, perm os.FileMode) error {
-
-	var logInfo logger.LogMessage = logger.LogMessage{LogType: logger.LogInfo, Ref: "checkFolder", Message: ""}
-	var logError logger.LogMessage = logger.LogMessage{LogType: logger.LogError, Ref: "checkFolder", Message: ""}
-
-	folder, err := os.ReadDir(slavePath)
-
-	if err != nil {
-
-		logError.Message = err.Error()
-		logger.LogChan <- logError
-
-		return err
-
-	}
-
-	for _, slEntry := range folder {
-
-		if slEntry.Name() == name {
-
-			return nil
-		}
-
-	}
-
-	err = os.Mkdir(slavePath+"/"+name, perm)
-
-	if err != nil {
-
-		logError.Message = err.Error()
-		logger.LogChan <- logError
-
-		return err
-
-	}
-
-	logInfo.Message = "Folder " + name + " created in " + slavePath
-	logger.LogChan <- logInfo
-
-	return nil
-}
-
-// func check slave folder and runs goroutine for every file to check if it still exists in the source folder
-// if it finds a subfolder it runs itself for subfolder
-func CheckSlaveFolder(masterPath, slavePath string) error {
-
-	var logCritical logger.LogMessage = logger.LogMessage{LogType: logger.LogCritical, Ref: "CheckSlaveFolder", Message: ""}
-
-	var wgCSF sync.WaitGroup
-
-	folder, err := os.ReadDir(slavePath)
-
-	if err != nil {
-		logCritical.Message = err.Error()
-		logger.LogChan <- logCritical
-		CriticalChan <- struct{}{}
-		return err
-	}
-
-	for _, entry := range folder {
-
-		if entry.IsDir() {
-
-			deleted, err := removeFolder(entry.Name(), masterPath, slavePath)
-
-			if !deleted && err == nil {
-				_ = CheckSlaveFolder(masterPath+"/"+entry.Name(), slavePath+"/"+entry.Name())
-			}
-
-		} else {
-
-			wgCSF.Add(1)
-
-			go func() {
-
-				defer wgCSF.Done()
-				_ = deleteFile(entry, masterPath, slavePath)
-
-			}()
-		}
-
-	}
-	wgCSF.Wait()
-	return nil
-}
-
-// check if subfolder  exists in the source folder. If not - delete the subfolder in slave
-func removeFolder(name, masterPath, slavePath string) (bool, error) {
-
-	var logInfo logger.LogMessage = logger.LogMessage{LogType: logger.LogInfo, Ref: "removeFolder", Message: ""}
-	var logError logger.LogMessage = logger.LogMessage{LogType: logger.LogError, Ref: "removeFolder", Message: ""}
-
-	folder, err := os.ReadDir(masterPath)
-
-	if err != nil {
-
-		logError.Message = err.Error()
-		logger.LogChan <- logError
-
-		return false, err
-
-	}
-
-	for _, msEntry := range folder {
-
-		if msEntry.Name() == name && msEntry.IsDir() {
-
-			return false, nil
-		}
-
-	}
-
-	_ = purgeFolder(slavePath + "/" + name)
-
-	err = os.Remove(slavePath + "/" + name)
-
-	if err != nil {
-
-		logError.Message = err.Error()
-		logger.LogChan <- logError
-
-		return false, err
-
-	}
-
-	logInfo.Message = "Folder " + slavePath + "/" + name + " deleted"
-	logger.LogChan <- logInfo
-
-	return true, nil
-}
-
-// func check if the file exists in the source folder. If not - delete the file
-func deleteFile(entry os.DirEntry, masterPath, slavePath string) error {
-
-	if entry.IsDir() {
-		return errors.New("not a file")
-	}
-
-	var logInfo logger.LogMessage = logger.LogMessage{LogType: logger.LogInfo, Ref: "deleteFile", Message: ""}
-	var logError logger.LogMessage = logger.LogMessage{LogType: logger.LogError, Ref: "deleteFile", Message: ""}
-
-	folder, err := os.ReadDir(masterPath)
-
-	if err != nil {
-
-		logError.Message = err.Error()
-		logger.LogChan <- logError
-
-		return err
-
-	}
-
-	exist := false
-
-	for _, msEntry := range folder {
-
-		if msEntry.Name() == entry.Name() {
-
-			exist = true
-		}
-
-	}
-
-	if !exist {
-
-		err = os.Remove(slavePath + "/" + entry.Name())
-
-		if err != nil {
-
-			logError.Message = err.Error()
-			logger.LogChan <- logError
-			return err
-
-		}
-
-		logInfo.Message = "File " + slavePath + "/" + entry.Name() + " deleted"
-		logger.LogChan <- logInfo
-
-	}
-	return nil
-}
-
-// func removes all files from a folder
-func purgeFolder(path string) error {
-
-	var logInfo logger.LogMessage = logger.LogMessage{LogType: logger.LogInfo, Ref: "purgeFolder", Message: ""}
-	var logError logger.LogMessage = logger.LogMessage{LogType: logger.LogError, Ref: "purgeFolder", Message: ""}
-
-	folder, err := os.ReadDir(path)
-
-	if err != nil {
-
-		logError.Message = err.Error()
-		logger.LogChan <- logError
-		return err
-
-	}
-
-	for _, entry := range folder {
-
-		err = os.Remove(path + "/" + entry.Name())
-
-		if err != nil {
-
-			logError.Message = err.Error()
-			logger.LogChan <- logError
-
-		}
-
-	}
-
-	logInfo.Message = "Folder " + path + " is purged"
-	logger.LogChan <- logInfo
-
-	return nil
-
-}
+package synch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"synchfolder/internal/logger"
+	"synchfolder/internal/state"
+	"synchfolder/internal/trash"
+	"time"
+)
+
+var CriticalChan chan struct{}
+
+// maximum number of files and folders deleted from the synch folder in one check, 0 means no limit
+var MaxDeletions int
+
+var ErrDeleteLimit = errors.New("deletion limit is reached")
+
+// PurgeError is returned when some entries of a folder can't be deleted
+type PurgeError struct {
+	Path   string
+	Errors []error
+}
+
+func (e *PurgeError) Error() string {
+
+	messages := make([]string, len(e.Errors))
+
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return "error purging " + e.Path + ": " + strings.Join(messages, "; ")
+}
+
+// func checks if the folder is not purged because of the deletion limit
+func (e *PurgeError) limited() bool {
+
+	for _, err := range e.Errors {
+
+		if err == ErrDeleteLimit {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deleteLimit counts deleted entries and stops deletion when the limit is reached
+type deleteLimit struct {
+	mu   sync.Mutex
+	left int
+}
+
+// index of synchronized files. If it is nil every file is compared on every check
+var State *state.DB
+
+// trash for deleted and overwritten files of the synch folder. If it is nil files are deleted permanently
+var Trash *trash.Trash
+
+func init() {
+
+	CriticalChan = make(chan struct{}, 2)
+}
+
+// func returns a limit of max deletions or nil if there is no limit
+func newDeleteLimit(max int) *deleteLimit {
+
+	if max <= 0 {
+		return nil
+	}
+
+	return &deleteLimit{left: max}
+}
+
+// func counts one deleted entry. ErrDeleteLimit is returned if no deletions are left.
+// A nil limit allows everything
+func (l *deleteLimit) take() error {
+
+	return l.takeAll(1)
+}
+
+// func counts count deleted entries at once. ErrDeleteLimit is returned and nothing is counted
+// if fewer deletions are left
+func (l *deleteLimit) takeAll(count int) error {
+
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.left < count {
+		return ErrDeleteLimit
+	}
+
+	l.left -= count
+
+	return nil
+}
+
+// func synchronizes the synch folder with the master folder: it scans both trees, plans
+// the operations and executes them. The error is returned only if one of the folders can't be read
+func Synch(masterPath, slavePath string) ([]Result, error) {
+
+	return globalJob(masterPath, slavePath).Synch()
+}
+
+// func creates and updates entries of the synch folder that differ from the master folder
+func CheckMasterFolder(masterPath, slavePath string) error {
+
+	_, _, err := globalJob(masterPath, slavePath).synchFolders(context.Background(), []string{""}, true, func(op Operation) bool { return !isDelete(op) })
+
+	return err
+}
+
+// func deletes entries of the synch folder that don't exist in the master folder
+func CheckSlaveFolder(masterPath, slavePath string) error {
+
+	_, _, err := globalJob(masterPath, slavePath).synchFolders(context.Background(), []string{""}, true, isDelete)
+
+	return err
+}
+
+// func checks only entries of the given folders without their subfolders.
+// Folders are relative to masterPath and slavePath. A folder that doesn't exist
+// in the source anymore is skipped, it is removed with its parent
+func CheckFolders(masterPath, slavePath string, folders []string) error {
+
+	return globalJob(masterPath, slavePath).CheckFolders(folders)
+}
+
+// func walks source and synch folders without changing anything and returns the operations that would be made
+func DryRun(masterPath, slavePath string) (*Plan, error) {
+
+	return globalJob(masterPath, slavePath).DryRun()
+}
+
+// func removes old entries of the trash t of the job by its retention settings
+func cleanTrash(t *trash.Trash, e env) {
+
+	if t == nil {
+		return
+	}
+
+	removed, err := t.Clean(time.Now())
+
+	for _, stamp := range removed {
+		e.send(logger.Info("cleanTrash", "trash folder removed").WithPath(filepath.Join(t.Root, stamp.UTC().Format(trash.StampLayout))))
+	}
+
+	if err != nil {
+		e.send(logger.Error("cleanTrash", "error cleaning trash").WithPath(t.Root).WithErr(err))
+	}
+}
+
+// func removes old entries of the trash. Checks that put something into the trash clean it too
+func CleanTrash() {
+
+	cleanTrash(Trash, env{})
+}
+
+// func checks if the operation deletes an entry of the synch folder
+func isDelete(op Operation) bool {
+
+	return op.Type == OpDeleteFile || op.Type == OpDeleteDir
+}
+
+// func that copy file from inPath to outPath. The file is written to a temporary file
+// in the same folder first and then renamed, so outPath is never seen half-written
+func copyFile(inPath, outPath string) error {
+
+	return copyFileMeta(inPath, outPath, PreserveMeta)
+}
+
+// func is copyFile that also copies the preserve attributes of inPath before the copy is renamed
+func copyFileMeta(inPath, outPath string, preserve Preserve) error {
+
+	return copyFileAbort(OS, inPath, outPath, preserve, nil)
+}
+
+// copy is stopped when abort is closed
+var errCopyAborted = errors.New("copy is aborted")
+
+// abortReader stops reading when abort is closed
+type abortReader struct {
+	r     io.Reader
+	abort <-chan struct{}
+}
+
+func (r abortReader) Read(p []byte) (int, error) {
+
+	select {
+	case <-r.abort:
+		return 0, errCopyAborted
+	default:
+	}
+
+	return r.r.Read(p)
+}
+
+// func is copyFileMeta for files of fsys that is rolled back when abort is closed: the temporary file
+// is removed and outPath is not changed. A nil abort never stops the copy
+func copyFileAbort(fsys FS, inPath, outPath string, preserve Preserve, abort <-chan struct{}) error {
+
+	in, err := fsys.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, tmp, err := createTemp(fsys, outPath)
+	if err != nil {
+		return err
+	}
+
+	done := false
+
+	defer func() {
+		if !done {
+			out.Close()
+			fsys.Remove(tmp)
+		}
+	}()
+
+	_, err = io.Copy(out, abortReader{r: in, abort: abort})
+	if err != nil {
+		return err
+	}
+
+	err = out.Sync()
+	if err != nil {
+		return err
+	}
+
+	if preserve.enabled() {
+
+		info, err := fsys.Stat(inPath)
+		if err != nil {
+			return err
+		}
+
+		err = preserve.apply(fsys, inPath, tmp, info)
+		if err != nil {
+			return err
+		}
+	}
+
+	done = true
+
+	err = out.Close()
+	if err == nil {
+		err = fsys.Rename(tmp, outPath)
+	}
+	if err != nil {
+		fsys.Remove(tmp)
+		return err
+	}
+
+	return syncFolder(fsys, filepath.Dir(outPath))
+}
+
+// func creates a folder in the synch folder of fsys if it doesn't exist
+func makeFolder(fsys FS, path string, perm os.FileMode) error {
+
+	err := fsys.Mkdir(path, perm)
+
+	if errors.Is(err, os.ErrExist) {
+
+		if info, statErr := fsys.Stat(path); statErr == nil && info.IsDir() {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// func deletes a file, a link or a special file of the synch folder of fsys
+func deleteFile(fsys FS, path string) error {
+
+	return fsys.Remove(path)
+}
+
+// func deletes a folder of the synch folder of fsys with its content
+func removeFolder(fsys FS, path string) error {
+
+	return removeTree(fsys, path, nil)
+}
+
+// func removes the whole content of a folder of fsys, nested folders are removed depth first
+func purgeFolder(fsys FS, path string) error {
+
+	return purgeTree(fsys, path, nil)
+}
+
+// func deletes a folder of fsys with its content. Deleted entries are counted by limit if it is set
+func removeTree(fsys FS, path string, limit *deleteLimit) error {
+
+	err := purgeTree(fsys, path, limit)
+
+	if err != nil {
+		return err
+	}
+
+	if err = limit.take(); err != nil {
+		return err
+	}
+
+	return fsys.Remove(path)
+}
+
+// func returns the number of entries under a folder of fsys
+func countTree(fsys FS, path string) (int, error) {
+
+	folder, err := fsys.ReadDir(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	count := len(folder)
+
+	for _, entry := range folder {
+
+		if !entry.IsDir() {
+			continue
+		}
+
+		nested, err := countTree(fsys, path+"/"+entry.Name())
+
+		if err != nil {
+			return 0, err
+		}
+
+		count += nested
+	}
+
+	return count, nil
+}
+
+// func removes the content of a folder of fsys depth first. An entry that can't be deleted doesn't stop
+// the others, errors of all entries are returned together and logged by the caller
+func purgeTree(fsys FS, path string, limit *deleteLimit) error {
+
+	folder, err := fsys.ReadDir(path)
+
+	if err != nil {
+		return err
+	}
+
+	purgeErr := &PurgeError{Path: path}
+
+	for _, entry := range folder {
+
+		entryPath := path + "/" + entry.Name()
+
+		if entry.IsDir() {
+			err = removeTree(fsys, entryPath, limit)
+
+		} else if err = limit.take(); err == nil {
+			err = fsys.Remove(entryPath)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if nested, ok := err.(*PurgeError); ok {
+			purgeErr.Errors = append(purgeErr.Errors, nested.Errors...)
+			continue
+		}
+
+		if err == ErrDeleteLimit {
+			purgeErr.Errors = append(purgeErr.Errors, err)
+			break
+		}
+
+		purgeErr.Errors = append(purgeErr.Errors, err)
+
+	}
+
+	if len(purgeErr.Errors) > 0 {
+		return purgeErr
+	}
+
+	return nil
+
+}
@@ -0,0 +1,68 @@
+//go:build linux
+
+package synch
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecials(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { Specials = SpecialSkip }()
+
+	masterPath := t.TempDir()
+
+	req.NoError(syscall.Mkfifo(masterPath+"/fifo", 0600))
+
+	cases := map[string]struct {
+		policy   string
+		isExists bool
+	}{
+		"skip": {
+			policy: SpecialSkip,
+		},
+
+		"recreate": {
+			policy:   SpecialRecreate,
+			isExists: true,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			slavePath := t.TempDir()
+
+			req.NoError(SetSpecials(cs.policy))
+
+			done := make(chan error)
+
+			// a fifo must not be opened, otherwise the check blocks
+			go func() { done <- CheckMasterFolder(masterPath, slavePath) }()
+
+			select {
+			case err := <-done:
+				req.NoError(err)
+			case <-time.After(5 * time.Second):
+				req.Fail("check is blocked by fifo")
+			}
+
+			info, err := os.Lstat(slavePath + "/fifo")
+
+			if cs.isExists {
+				req.NoError(err)
+				req.NotZero(info.Mode() & os.ModeNamedPipe)
+			} else {
+				req.ErrorIs(err, os.ErrNotExist)
+			}
+		})
+	}
+
+}
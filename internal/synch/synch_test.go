@@ -1,444 +1,1010 @@
-package synch
-
-import (
-	"os"
-	"path/filepath"
-	"testing"
-
-	"github.com/stretchr/testify/require"
-)
-
-func TestChekMasterFolder(t *testing.T) {
-
-	root, _ := filepath.Abs("../../")
-
-	req := require.New(t)
-
-	cases := map[string]struct {
-		masterFolder string
-		slavePath    string
-		isError      bool
-		errMsg       string
-	}{
-		"Master folder exists": {
-			masterFolder: root + "/test/temp/master",
-			slavePath:    root + "/test/temp/slave",
-			isError:      false,
-		},
-
-		"No Master folder": {
-			masterFolder: root + "/test/temp2/master",
-			slavePath:    root + "/test/temp/slave",
-			isError:      true,
-			errMsg:       "no such file or directory",
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			err := CheckMasterFolder(cs.masterFolder, cs.slavePath)
-
-			if cs.isError {
-				req.Error(err)
-				req.Contains(err.Error(), cs.errMsg)
-			} else {
-				req.NoError(err)
-			}
-		})
-	}
-
-}
-
-func TestChekFile(t *testing.T) {
-
-	root, _ := filepath.Abs("../../")
-
-	req := require.New(t)
-
-	folder, _ := os.ReadDir(root + "/test/temp/master")
-	file := folder[0]
-
-	cases := map[string]struct {
-		masterFolder string
-		slavePath    string
-		isError      bool
-		errMsg       string
-	}{
-		"Slave folder exists": {
-			masterFolder: root + "/test/temp/master",
-			slavePath:    root + "/test/temp/slave",
-			isError:      false,
-		},
-
-		"No Slave folder": {
-			masterFolder: root + "/test/temp/master",
-			slavePath:    root + "/test/temp2/slave",
-			isError:      true,
-			errMsg:       "no such file or directory",
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			err := checkFile(file, cs.masterFolder, cs.slavePath)
-
-			if cs.isError {
-				req.Error(err)
-				req.Contains(err.Error(), cs.errMsg)
-			} else {
-				req.NoError(err)
-			}
-		})
-	}
-
-}
-
-func TestCopyFile(t *testing.T) {
-
-	root, _ := filepath.Abs("../../")
-
-	req := require.New(t)
-
-	_ = os.Remove(root + "/test/temp/slave/file1")
-
-	cases := map[string]struct {
-		inPath  string
-		outPath string
-		isError bool
-		errMsg  string
-	}{
-		"Master file exists": {
-			inPath:  root + "/test/temp/master/file1",
-			outPath: root + "/test/temp/slave/file1",
-			isError: false,
-		},
-
-		"No Master file": {
-			inPath:  root + "/test/temp/master/file11",
-			outPath: root + "/test/temp/file11",
-			isError: true,
-			errMsg:  "no such file or directory",
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			err := copyFile(cs.inPath, cs.outPath)
-
-			if cs.isError {
-				req.Error(err)
-				req.Contains(err.Error(), cs.errMsg)
-			} else {
-				req.NoError(err)
-				_, err = os.Open(root + "/test/temp/slave/file1")
-				req.NoError(err)
-			}
-		})
-
-	}
-	_ = os.Remove(root + "/test/temp/slave/file1")
-}
-
-func TestCheckFolder(t *testing.T) {
-
-	root, _ := filepath.Abs("../../")
-
-	req := require.New(t)
-
-	cases := map[string]struct {
-		name      string
-		slavePath string
-		isError   bool
-		errMsg    string
-	}{
-		"Slave folder exists": {
-			name:      "testdir",
-			slavePath: root + "/test/temp/slave",
-			isError:   false,
-		},
-
-		"No Slave folder": {
-			name:      "testdir",
-			slavePath: root + "/test/temp/slave2",
-			isError:   true,
-			errMsg:    "no such file or directory",
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			err := checkFolder(cs.name, cs.slavePath, 0755)
-
-			if cs.isError {
-				req.Error(err)
-				req.Contains(err.Error(), cs.errMsg)
-			} else {
-				req.NoError(err)
-				_, err = os.ReadDir(root + "/test/temp/slave/testdir")
-				req.NoError(err)
-			}
-		})
-
-	}
-	_ = os.Remove(root + "/test/temp/slave/testdir")
-
-}
-
-func TestChekSlaveFolder(t *testing.T) {
-
-	root, _ := filepath.Abs("../../")
-
-	req := require.New(t)
-
-	cases := map[string]struct {
-		slavePath string
-		isError   bool
-		errMsg    string
-	}{
-		"Slave folder exists": {
-
-			slavePath: root + "/test/temp/slave",
-			isError:   false,
-		},
-
-		"No Slave folder": {
-
-			slavePath: root + "/test/temp2/slave",
-			isError:   true,
-			errMsg:    "no such file or directory",
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			err := CheckSlaveFolder(root+"/test/temp/master", cs.slavePath)
-
-			if cs.isError {
-				req.Error(err)
-				req.Contains(err.Error(), cs.errMsg)
-			} else {
-				req.NoError(err)
-			}
-		})
-	}
-
-}
-
-func TestRemoveFolder(t *testing.T) {
-
-	root, _ := filepath.Abs("../../")
-
-	req := require.New(t)
-
-	_ = os.Mkdir(root+"/test/temp/master/testdir", 0755)
-	_ = os.Mkdir(root+"/test/temp/slave/testdir", 0755)
-	_ = os.Mkdir(root+"/test/temp/slave/testdir2", 0755)
-
-	cases := map[string]struct {
-		name       string
-		masterPath string
-		slavePath  string
-		isError    bool
-		isDeleted  bool
-		errMsg     string
-	}{
-		"Wrong Master Path": {
-			name:       "testdir",
-			masterPath: root + "/test/temp/wrongmaster",
-			slavePath:  root + "/test/temp/slave",
-			isError:    true,
-			errMsg:     "no such file or directory",
-		},
-
-		"Folder exists in master": {
-			name:       "testdir",
-			masterPath: root + "/test/temp/master",
-			slavePath:  root + "/test/temp/slave",
-			isError:    false,
-			isDeleted:  false,
-		},
-
-		"Folder doesn't exists in master": {
-			name:       "testdir2",
-			masterPath: root + "/test/temp/master",
-			slavePath:  root + "/test/temp/slave",
-			isError:    false,
-			isDeleted:  true,
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			deleted, err := removeFolder(cs.name, cs.masterPath, cs.slavePath)
-
-			if cs.isError {
-				req.Error(err)
-				req.Contains(err.Error(), cs.errMsg)
-			} else if cs.isDeleted {
-				req.NoError(err)
-				req.True(deleted)
-				_, err = os.ReadDir(cs.slavePath + "/" + name)
-				req.Error(err)
-				req.Contains(err.Error(), "no such file or directory")
-
-			} else {
-				req.NoError(err)
-				req.False(deleted)
-			}
-		})
-
-	}
-	_ = os.Remove(root + "/test/temp/slave/testdir")
-	_ = os.Remove(root + "/test/temp/master/testdir")
-
-}
-
-func TestDeleteFile(t *testing.T) {
-
-	root, _ := filepath.Abs("../../")
-
-	req := require.New(t)
-
-	var file1, file2 os.DirEntry
-
-	_ = copyFile(root+"/test/temp/master/file1", root+"/test/temp/slave/file1")
-	_ = copyFile(root+"/test/temp/master/file1", root+"/test/temp/slave/file2")
-
-	folder, _ := os.ReadDir(root + "/test/temp/slave")
-	for _, file := range folder {
-
-		if file.Name() == "file1" {
-			file1 = file
-		} else {
-			file2 = file
-		}
-	}
-
-	cases := map[string]struct {
-		entry      os.DirEntry
-		masterPath string
-		slavePath  string
-		isError    bool
-		errMsg     string
-	}{
-		"Wrong Master Path": {
-			entry:      file1,
-			masterPath: root + "/test/temp/wrongmaster",
-			slavePath:  root + "/test/temp/slave",
-			isError:    true,
-			errMsg:     "no such file or directory",
-		},
-
-		"File exists in master": {
-			entry:      file1,
-			masterPath: root + "/test/temp/master",
-			slavePath:  root + "/test/temp/slave",
-			isError:    false,
-		},
-
-		"File doesn't exists in master": {
-			entry:      file2,
-			masterPath: root + "/test/temp/master",
-			slavePath:  root + "/test/temp/slave",
-			isError:    false,
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			err := deleteFile(cs.entry, cs.masterPath, cs.slavePath)
-
-			if cs.isError {
-				req.Error(err)
-				req.Contains(err.Error(), cs.errMsg)
-			} else {
-				req.NoError(err)
-
-				if cs.entry.Name() == "file1" {
-					_, err = os.Open(cs.slavePath + "/" + cs.entry.Name())
-					req.NoError(err)
-				} else {
-					_, err = os.Open(cs.slavePath + "/" + cs.entry.Name())
-					req.Error(err)
-					req.Contains(err.Error(), "no such file or directory")
-				}
-			}
-		})
-
-	}
-	_ = os.Remove(root + "/test/temp/slave/file1")
-
-}
-
-func TestPurgeFolder(t *testing.T) {
-
-	root, _ := filepath.Abs("../../")
-
-	req := require.New(t)
-
-	_ = copyFile(root+"/test/temp/master/file1", root+"/test/temp/slave/file1")
-
-	cases := map[string]struct {
-		slavePath string
-		isError   bool
-		errMsg    string
-	}{
-		"Wrong Slave Path": {
-			slavePath: root + "/test/temp/slave2",
-			isError:   true,
-			errMsg:    "no such file or directory",
-		},
-
-		"File exists in slave": {
-
-			slavePath: root + "/test/temp/slave",
-			isError:   false,
-		},
-	}
-
-	for name, cs := range cases {
-		t.Run(name, func(t *testing.T) {
-
-			err := purgeFolder(cs.slavePath)
-
-			if cs.isError {
-				req.Error(err)
-				req.Contains(err.Error(), cs.errMsg)
-			} else {
-				req.NoError(err)
-
-				_, err = os.Open(cs.slavePath + "/file1")
-				req.Error(err)
-				req.Contains(err.Error(), "no such file or directory")
-			}
-
-		})
-
-	}
-	_ = os.Remove(root + "/test/temp/slave/file1")
-
-}
-
-func BenchmarkCopyFile(b *testing.B) {
-
-	for i := 0; i < b.N; i++ {
-		b.StopTimer()
-		root, _ := filepath.Abs("../../")
-		inPath := root + "/test/temp/master/file1"
-		outPath := root + "/test/temp/slave/file1"
-		b.StartTimer()
-		_ = copyFile(inPath, outPath)
-
-		b.StopTimer()
-		_ = os.Remove(outPath)
-		b.StartTimer()
-	}
-
-}
+package synch
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"synchfolder/internal/logger"
+	"synchfolder/internal/state"
+	"synchfolder/internal/trash"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+
+	// nobody runs the logger in tests, so messages are discarded to keep senders from blocking
+	go func() {
+		for range logger.LogChan {
+		}
+	}()
+
+	os.Exit(m.Run())
+}
+
+func TestChekMasterFolder(t *testing.T) {
+
+	root, _ := filepath.Abs("../../")
+
+	req := require.New(t)
+
+	cases := map[string]struct {
+		masterFolder string
+		slavePath    string
+		isError      bool
+		errMsg       string
+	}{
+		"Master folder exists": {
+			masterFolder: root + "/test/temp/master",
+			slavePath:    root + "/test/temp/slave",
+			isError:      false,
+		},
+
+		"No Master folder": {
+			masterFolder: root + "/test/temp2/master",
+			slavePath:    root + "/test/temp/slave",
+			isError:      true,
+			errMsg:       "no such file or directory",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := CheckMasterFolder(cs.masterFolder, cs.slavePath)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+			}
+		})
+	}
+
+}
+
+func TestSynch(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.MkdirAll(masterPath+"/a/b", 0755))
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/a/b/file2", []byte("test"), 0644))
+	req.NoError(os.MkdirAll(slavePath+"/extra", 0755))
+	req.NoError(os.WriteFile(slavePath+"/extra/file3", []byte("test"), 0644))
+
+	results, err := Synch(masterPath, slavePath)
+	req.NoError(err)
+	req.Len(results, 5)
+
+	for _, result := range results {
+		req.NoError(result.Err, result.Op.Path)
+	}
+
+	data, err := os.ReadFile(slavePath + "/a/b/file2")
+	req.NoError(err)
+	req.Equal("test", string(data))
+
+	_, err = os.Stat(slavePath + "/extra")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	// nothing is left to do
+	results, err = Synch(masterPath, slavePath)
+	req.NoError(err)
+	req.Empty(results)
+
+	_, err = Synch(masterPath+"/wrong", slavePath)
+	req.Error(err)
+	req.Contains(err.Error(), "no such file or directory")
+
+}
+
+func TestSynchState(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("flag=true"), 0644))
+
+	db, err := state.Open(t.TempDir() + "/state.json")
+	req.NoError(err)
+
+	State = db
+	defer func() { State = nil }()
+
+	_, err = Synch(masterPath, slavePath)
+	req.NoError(err)
+
+	synced := func() bool {
+
+		msInfo, err := os.Stat(masterPath + "/file1")
+		req.NoError(err)
+		slInfo, err := os.Stat(slavePath + "/file1")
+		req.NoError(err)
+
+		return db.Unchanged(masterPath+"/file1", msInfo) && db.Unchanged(slavePath+"/file1", slInfo)
+	}
+
+	req.True(synced())
+
+	// the copy is changed behind the synchronizer's back
+	req.NoError(os.WriteFile(slavePath+"/file1", []byte("flag=nope"), 0644))
+	later := time.Now().Add(time.Minute)
+	req.NoError(os.Chtimes(slavePath+"/file1", later, later))
+	req.False(synced())
+
+	_, err = Synch(masterPath, slavePath)
+	req.NoError(err)
+
+	data, err := os.ReadFile(slavePath + "/file1")
+	req.NoError(err)
+	req.Equal("flag=true", string(data))
+	req.True(synced())
+
+	// deleted files are removed from the state
+	req.NoError(os.Remove(masterPath + "/file1"))
+
+	_, err = Synch(masterPath, slavePath)
+	req.NoError(err)
+
+	_, ok := db.Get(slavePath + "/file1")
+	req.False(ok)
+
+}
+
+func TestCopyFile(t *testing.T) {
+
+	root, _ := filepath.Abs("../../")
+
+	req := require.New(t)
+
+	_ = os.Remove(root + "/test/temp/slave/file1")
+
+	cases := map[string]struct {
+		inPath  string
+		outPath string
+		isError bool
+		errMsg  string
+	}{
+		"Master file exists": {
+			inPath:  root + "/test/temp/master/file1",
+			outPath: root + "/test/temp/slave/file1",
+			isError: false,
+		},
+
+		"No Master file": {
+			inPath:  root + "/test/temp/master/file11",
+			outPath: root + "/test/temp/file11",
+			isError: true,
+			errMsg:  "no such file or directory",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := copyFile(cs.inPath, cs.outPath)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+				_, err = os.Open(root + "/test/temp/slave/file1")
+				req.NoError(err)
+			}
+		})
+
+	}
+	_ = os.Remove(root + "/test/temp/slave/file1")
+}
+
+func TestMakeFolder(t *testing.T) {
+
+	root, _ := filepath.Abs("../../")
+
+	req := require.New(t)
+
+	cases := map[string]struct {
+		name      string
+		slavePath string
+		isError   bool
+		errMsg    string
+	}{
+		"Slave folder exists": {
+			name:      "testdir",
+			slavePath: root + "/test/temp/slave",
+			isError:   false,
+		},
+
+		"No Slave folder": {
+			name:      "testdir",
+			slavePath: root + "/test/temp/slave2",
+			isError:   true,
+			errMsg:    "no such file or directory",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := makeFolder(OS, cs.slavePath+"/"+cs.name, 0755)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+				_, err = os.ReadDir(root + "/test/temp/slave/testdir")
+				req.NoError(err)
+
+				// an existing folder is not an error
+				req.NoError(makeFolder(OS, cs.slavePath+"/"+cs.name, 0755))
+			}
+		})
+
+	}
+	_ = os.Remove(root + "/test/temp/slave/testdir")
+
+}
+
+func TestChekSlaveFolder(t *testing.T) {
+
+	root, _ := filepath.Abs("../../")
+
+	req := require.New(t)
+
+	cases := map[string]struct {
+		slavePath string
+		isError   bool
+		errMsg    string
+	}{
+		"Slave folder exists": {
+
+			slavePath: root + "/test/temp/slave",
+			isError:   false,
+		},
+
+		"No Slave folder": {
+
+			slavePath: root + "/test/temp2/slave",
+			isError:   true,
+			errMsg:    "no such file or directory",
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := CheckSlaveFolder(root+"/test/temp/master", cs.slavePath)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+			}
+		})
+	}
+
+}
+
+func TestRemoveFolder(t *testing.T) {
+
+	root, _ := filepath.Abs("../../")
+
+	req := require.New(t)
+
+	_ = os.Mkdir(root+"/test/temp/slave/testdir2", 0755)
+	_ = copyFile(root+"/test/temp/master/file1", root+"/test/temp/slave/testdir2/file1")
+
+	cases := map[string]struct {
+		path    string
+		isError bool
+		errMsg  string
+	}{
+		"No folder": {
+			path:    root + "/test/temp/slave/wrongdir",
+			isError: true,
+			errMsg:  "no such file or directory",
+		},
+
+		"Folder exists": {
+			path:    root + "/test/temp/slave/testdir2",
+			isError: false,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := removeFolder(OS, cs.path)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+				_, err = os.ReadDir(cs.path)
+				req.Error(err)
+				req.Contains(err.Error(), "no such file or directory")
+			}
+		})
+
+	}
+	_ = os.RemoveAll(root + "/test/temp/slave/testdir2")
+
+}
+
+func TestDeleteFile(t *testing.T) {
+
+	root, _ := filepath.Abs("../../")
+
+	req := require.New(t)
+
+	_ = copyFile(root+"/test/temp/master/file1", root+"/test/temp/slave/file2")
+
+	cases := map[string]struct {
+		path    string
+		isError bool
+		errMsg  string
+	}{
+		"No file": {
+			path:    root + "/test/temp/slave/file11",
+			isError: true,
+			errMsg:  "no such file or directory",
+		},
+
+		"File exists": {
+			path:    root + "/test/temp/slave/file2",
+			isError: false,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := deleteFile(OS, cs.path)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+				_, err = os.Open(cs.path)
+				req.Error(err)
+				req.Contains(err.Error(), "no such file or directory")
+			}
+		})
+
+	}
+	_ = os.Remove(root + "/test/temp/slave/file2")
+
+}
+
+func TestPurgeFolder(t *testing.T) {
+
+	root, _ := filepath.Abs("../../")
+
+	req := require.New(t)
+
+	_ = copyFile(root+"/test/temp/master/file1", root+"/test/temp/slave/file1")
+
+	cases := map[string]struct {
+		slavePath string
+		isError   bool
+		errMsg    string
+	}{
+		"Wrong Slave Path": {
+			slavePath: root + "/test/temp/slave2",
+			isError:   true,
+			errMsg:    "no such file or directory",
+		},
+
+		"File exists in slave": {
+
+			slavePath: root + "/test/temp/slave",
+			isError:   false,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			err := purgeFolder(OS, cs.slavePath)
+
+			if cs.isError {
+				req.Error(err)
+				req.Contains(err.Error(), cs.errMsg)
+			} else {
+				req.NoError(err)
+
+				_, err = os.Open(cs.slavePath + "/file1")
+				req.Error(err)
+				req.Contains(err.Error(), "no such file or directory")
+			}
+
+		})
+
+	}
+	_ = os.Remove(root + "/test/temp/slave/file1")
+
+}
+
+func BenchmarkCopyFile(b *testing.B) {
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		root, _ := filepath.Abs("../../")
+		inPath := root + "/test/temp/master/file1"
+		outPath := root + "/test/temp/slave/file1"
+		b.StartTimer()
+		_ = copyFile(inPath, outPath)
+
+		b.StopTimer()
+		_ = os.Remove(outPath)
+		b.StartTimer()
+	}
+
+}
+
+// func writes folders with files of size bytes each into root
+func makeTree(b *testing.B, root string, folders, files, size int) {
+
+	data := make([]byte, size)
+
+	for f := 0; f < folders; f++ {
+
+		folder := root + "/folder" + strconv.Itoa(f)
+
+		if err := os.Mkdir(folder, 0755); err != nil {
+			b.Fatal(err)
+		}
+
+		for n := 0; n < files; n++ {
+
+			if err := os.WriteFile(folder+"/file"+strconv.Itoa(n), data, 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// the whole tree is copied into an empty synch folder on every iteration. files/s is the throughput,
+// goroutines is the most goroutines seen while copying: it depends on the workers, not on the tree
+func BenchmarkSynchTree(b *testing.B) {
+
+	trees := []struct {
+		folders int
+		files   int
+	}{
+		{10, 100},
+		{50, 100},
+	}
+
+	workers := []struct {
+		data int
+		meta int
+	}{
+		{1, 1},
+		{4, 8},
+		{8, 16},
+	}
+
+	for _, tree := range trees {
+
+		masterPath := b.TempDir()
+		makeTree(b, masterPath, tree.folders, tree.files, 1024)
+
+		for _, w := range workers {
+
+			name := "files=" + strconv.Itoa(tree.folders*tree.files) + "/workers=" + strconv.Itoa(w.data) + "+" + strconv.Itoa(w.meta)
+
+			b.Run(name, func(b *testing.B) {
+
+				slavePath := b.TempDir()
+				peak := 0
+
+				job := &Job{Master: masterPath, Slave: slavePath, Options: Options{
+					Logger:      Discard,
+					Compare:     CompareSize,
+					Workers:     w.data,
+					MetaWorkers: w.meta,
+					Pool:        NewPoolLimits(w.data, w.meta),
+					Progress: func(done, total int, result Result) {
+						if n := runtime.NumGoroutine(); n > peak {
+							peak = n
+						}
+					},
+				}}
+
+				var elapsed time.Duration
+
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+
+					start := time.Now()
+
+					if _, err := job.Synch(); err != nil {
+						b.Fatal(err)
+					}
+
+					elapsed += time.Since(start)
+
+					b.StopTimer()
+
+					entries, _ := os.ReadDir(slavePath)
+
+					for _, entry := range entries {
+						_ = os.RemoveAll(slavePath + "/" + entry.Name())
+					}
+
+					b.StartTimer()
+				}
+
+				b.ReportMetric(float64(b.N*tree.folders*tree.files)/elapsed.Seconds(), "files/s")
+				b.ReportMetric(float64(peak), "goroutines")
+			})
+		}
+	}
+
+}
+
+func TestCheckFolders(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.MkdirAll(masterPath+"/a/b", 0755))
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/a/file2", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/a/b/file3", []byte("test"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/deleted", []byte("test"), 0644))
+
+	req.NoError(CheckFolders(masterPath, slavePath, []string{"", "a", "gone"}))
+
+	_, err := os.Stat(slavePath + "/file1")
+	req.NoError(err)
+	_, err = os.Stat(slavePath + "/a/file2")
+	req.NoError(err)
+	_, err = os.Stat(slavePath + "/a/b")
+	req.NoError(err)
+	_, err = os.Stat(slavePath + "/deleted")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	// subfolders are not checked unless they are given
+	_, err = os.Stat(slavePath + "/a/b/file3")
+	req.ErrorIs(err, os.ErrNotExist)
+
+}
+
+func TestSymlinks(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { Symlinks = SymlinkCopy }()
+
+	masterPath := t.TempDir()
+
+	req.NoError(os.MkdirAll(masterPath+"/dir", 0755))
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(masterPath+"/dir/file2", []byte("test"), 0644))
+	req.NoError(os.Symlink("file1", masterPath+"/flink"))
+	req.NoError(os.Symlink("dir", masterPath+"/dlink"))
+	req.NoError(os.Symlink("..", masterPath+"/dir/loop"))
+
+	cases := map[string]struct {
+		policy string
+		check  func(slavePath string)
+	}{
+		"copy": {
+			policy: SymlinkCopy,
+			check: func(slavePath string) {
+
+				target, err := os.Readlink(slavePath + "/flink")
+				req.NoError(err)
+				req.Equal("file1", target)
+
+				target, err = os.Readlink(slavePath + "/dir/loop")
+				req.NoError(err)
+				req.Equal("..", target)
+			},
+		},
+
+		"follow": {
+			policy: SymlinkFollow,
+			check: func(slavePath string) {
+
+				info, err := os.Lstat(slavePath + "/flink")
+				req.NoError(err)
+				req.True(info.Mode().IsRegular())
+
+				info, err = os.Lstat(slavePath + "/dlink/file2")
+				req.NoError(err)
+				req.True(info.Mode().IsRegular())
+
+				// the loop is not followed
+				_, err = os.Lstat(slavePath + "/dir/loop")
+				req.ErrorIs(err, os.ErrNotExist)
+
+				// followed folders are not deleted from the slave folder
+				req.NoError(CheckSlaveFolder(masterPath, slavePath))
+				_, err = os.Lstat(slavePath + "/dlink/file2")
+				req.NoError(err)
+			},
+		},
+
+		"skip": {
+			policy: SymlinkSkip,
+			check: func(slavePath string) {
+
+				_, err := os.Lstat(slavePath + "/flink")
+				req.ErrorIs(err, os.ErrNotExist)
+				_, err = os.Lstat(slavePath + "/dlink")
+				req.ErrorIs(err, os.ErrNotExist)
+			},
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			slavePath := t.TempDir()
+
+			req.NoError(SetSymlinks(cs.policy))
+			req.NoError(CheckMasterFolder(masterPath, slavePath))
+
+			cs.check(slavePath)
+		})
+	}
+
+}
+
+func TestHardLinks(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { HardLinks = false }()
+
+	masterPath := t.TempDir()
+
+	req.NoError(os.MkdirAll(masterPath+"/dir", 0755))
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("test"), 0644))
+	req.NoError(os.Link(masterPath+"/file1", masterPath+"/file2"))
+	req.NoError(os.Link(masterPath+"/file1", masterPath+"/dir/file3"))
+
+	cases := map[string]struct {
+		hardLinks bool
+		isLinked  bool
+	}{
+		"links preserved": {
+			hardLinks: true,
+			isLinked:  true,
+		},
+
+		"links copied": {
+			hardLinks: false,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			slavePath := t.TempDir()
+
+			HardLinks = cs.hardLinks
+			req.NoError(CheckMasterFolder(masterPath, slavePath))
+
+			first, err := os.Stat(slavePath + "/file1")
+			req.NoError(err)
+
+			for _, path := range []string{"/file2", "/dir/file3"} {
+
+				info, err := os.Stat(slavePath + path)
+				req.NoError(err)
+				req.Equal(cs.isLinked, os.SameFile(first, info), path)
+			}
+		})
+	}
+
+}
+
+func TestSetPolicies(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() {
+		Symlinks = SymlinkCopy
+		Specials = SpecialSkip
+		HardLinks = false
+	}()
+
+	req.NoError(SetSymlinks("follow"))
+	req.Equal(SymlinkFollow, Symlinks)
+	req.EqualError(SetSymlinks("keep"), "symlinks policy is not set in config. Default policy COPY")
+
+	req.NoError(SetSpecials("recreate"))
+	req.Equal(SpecialRecreate, Specials)
+	req.EqualError(SetSpecials("copy"), "specials policy is not set in config. Default policy SKIP")
+
+}
+
+func TestRemoveNestedFolder(t *testing.T) {
+
+	req := require.New(t)
+
+	slavePath := t.TempDir()
+
+	req.NoError(os.MkdirAll(slavePath+"/dir/a/b/c/d", 0755))
+	req.NoError(os.MkdirAll(slavePath+"/dir/e", 0755))
+	req.NoError(os.WriteFile(slavePath+"/dir/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/dir/a/b/file2", []byte("test"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/dir/a/b/c/d/file3", []byte("test"), 0644))
+	req.NoError(os.Symlink("/", slavePath+"/dir/a/root"))
+
+	req.NoError(removeFolder(OS, slavePath+"/dir"))
+
+	_, err := os.Lstat(slavePath + "/dir")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not checked for root")
+	}
+
+	// an entry that can't be deleted doesn't stop the others
+	req.NoError(os.MkdirAll(slavePath+"/dir/locked", 0755))
+	req.NoError(os.MkdirAll(slavePath+"/dir/open/sub", 0755))
+	req.NoError(os.WriteFile(slavePath+"/dir/locked/file1", []byte("test"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/dir/open/sub/file2", []byte("test"), 0644))
+	req.NoError(os.Chmod(slavePath+"/dir/locked", 0555))
+
+	defer func() { _ = os.Chmod(slavePath+"/dir/locked", 0755) }()
+
+	err = removeFolder(OS, slavePath+"/dir")
+
+	var purgeErr *PurgeError
+
+	req.ErrorAs(err, &purgeErr)
+	req.Len(purgeErr.Errors, 1)
+	req.ErrorIs(purgeErr.Errors[0], os.ErrPermission)
+
+	_, err = os.Stat(slavePath + "/dir/locked/file1")
+	req.NoError(err)
+	_, err = os.Stat(slavePath + "/dir/open")
+	req.ErrorIs(err, os.ErrNotExist)
+
+}
+
+func TestSynchNestedDeletion(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() {
+		MaxDeletions = 0
+		Trash = nil
+	}()
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	req.NoError(os.MkdirAll(masterPath+"/keep", 0755))
+
+	makeTree := func() {
+
+		for _, dir := range []string{"/keep/gone/a/b/c", "/gone/x/y"} {
+
+			req.NoError(os.MkdirAll(slavePath+dir, 0755))
+			req.NoError(os.WriteFile(slavePath+dir+"/file1", []byte("test"), 0644))
+		}
+	}
+
+	cases := map[string]struct {
+		maxDeletions int
+		isTrash      bool
+		isDeleted    bool
+	}{
+		"no limit": {
+			isDeleted: true,
+		},
+
+		"limit is higher": {
+			maxDeletions: 11,
+			isDeleted:    true,
+		},
+
+		"limit is reached": {
+			maxDeletions: 3,
+		},
+
+		"limit is higher with trash": {
+			maxDeletions: 9,
+			isTrash:      true,
+			isDeleted:    true,
+		},
+
+		// folders moved to the trash are counted with their content
+		"limit is reached with trash": {
+			maxDeletions: 3,
+			isTrash:      true,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			makeTree()
+
+			MaxDeletions = cs.maxDeletions
+			Trash = nil
+
+			if cs.isTrash {
+				tr, err := trash.Open(t.TempDir(), 0, 0)
+				req.NoError(err)
+				Trash = tr
+			}
+
+			results, err := Synch(masterPath, slavePath)
+			req.NoError(err)
+
+			_, goneErr := os.Stat(slavePath + "/gone")
+			_, nestedErr := os.Stat(slavePath + "/keep/gone")
+
+			if cs.isDeleted {
+
+				for _, result := range results {
+					req.NoError(result.Err)
+				}
+
+				req.ErrorIs(goneErr, os.ErrNotExist)
+				req.ErrorIs(nestedErr, os.ErrNotExist)
+				return
+			}
+
+			// nothing more than the limit is deleted, the rest goes on the next checks
+			count := 0
+
+			_ = filepath.WalkDir(slavePath, func(path string, entry os.DirEntry, err error) error {
+				count++
+				return nil
+			})
+
+			req.Equal(11-cs.maxDeletions, count)
+
+			for i := 0; i < 5 && count > 2; i++ {
+
+				_, err = Synch(masterPath, slavePath)
+				req.NoError(err)
+
+				count = 0
+
+				_ = filepath.WalkDir(slavePath, func(path string, entry os.DirEntry, err error) error {
+					count++
+					return nil
+				})
+			}
+
+			req.Equal(2, count)
+		})
+	}
+
+}
+
+func TestSynchTrash(t *testing.T) {
+
+	req := require.New(t)
+
+	masterPath := t.TempDir()
+	slavePath := t.TempDir()
+
+	tr, err := trash.Open(slavePath+"/.trash", 0, 0)
+	req.NoError(err)
+
+	Trash = tr
+	defer func() { Trash = nil }()
+
+	req.NoError(os.WriteFile(masterPath+"/file1", []byte("new"), 0644))
+	req.NoError(os.WriteFile(slavePath+"/file1", []byte("old!"), 0644))
+	req.NoError(os.MkdirAll(slavePath+"/gone/sub", 0755))
+	req.NoError(os.WriteFile(slavePath+"/gone/sub/file2", []byte("test"), 0644))
+
+	results, err := Synch(masterPath, slavePath)
+	req.NoError(err)
+	req.Len(results, 2)
+
+	for _, result := range results {
+		req.NoError(result.Err)
+	}
+
+	data, err := os.ReadFile(slavePath + "/file1")
+	req.NoError(err)
+	req.Equal("new", string(data))
+
+	_, err = os.Stat(slavePath + "/gone")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	// the trash inside the synch folder is not deleted
+	stamps, err := tr.Stamps()
+	req.NoError(err)
+	req.Len(stamps, 1)
+
+	req.NoError(tr.Restore("file1", time.Time{}, t.TempDir()+"/file1"))
+
+	folder := tr.Root + "/" + stamps[0].Format(trash.StampLayout)
+
+	data, err = os.ReadFile(folder + "/file1")
+	req.NoError(err)
+	req.Equal("old!", string(data))
+
+	data, err = os.ReadFile(folder + "/gone/sub/file2")
+	req.NoError(err)
+	req.Equal("test", string(data))
+
+	results, err = Synch(masterPath, slavePath)
+	req.NoError(err)
+	req.Empty(results)
+
+}
+
+func TestSynchTrashPaths(t *testing.T) {
+
+	req := require.New(t)
+
+	defer func() { Trash = nil }()
+
+	cwd, err := os.Getwd()
+	req.NoError(err)
+
+	cases := map[string]func(slavePath string) string{
+		"trailing slash": func(slavePath string) string { return slavePath + "/" },
+
+		"relative path": func(slavePath string) string {
+			rel, err := filepath.Rel(cwd, slavePath)
+			req.NoError(err)
+			return rel
+		},
+	}
+
+	for name, slave := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			masterPath := t.TempDir()
+			slavePath := t.TempDir()
+
+			tr, err := trash.Open(slavePath+"/.trash", 0, 0)
+			req.NoError(err)
+
+			Trash = tr
+
+			req.NoError(os.WriteFile(masterPath+"/file1", []byte("new"), 0644))
+
+			// the trash is never planned for deletion
+			plan, err := globalJob(masterPath, slave(slavePath)).DryRun()
+			req.NoError(err)
+			req.Len(plan.Ops, 1)
+			req.Equal(OpCopyFile, plan.Ops[0].Type)
+
+			results, err := Synch(masterPath, slave(slavePath))
+			req.NoError(err)
+			req.Len(results, 1)
+			req.NoError(results[0].Err)
+
+			stamps, err := tr.Stamps()
+			req.NoError(err)
+			req.Empty(stamps)
+		})
+	}
+
+}
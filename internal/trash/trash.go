@@ -0,0 +1,446 @@
+package trash
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// layout of the names of trash folders, one folder for every check that deleted something
+const StampLayout = "2006-01-02T15-04-05.000000000"
+
+// Trash keeps files and folders deleted or overwritten in the synch folder
+type Trash struct {
+	Root    string
+	MaxAge  time.Duration // entries older than MaxAge are removed, 0 means no limit
+	MaxSize int64         // the oldest entries are removed while the trash is bigger than MaxSize, 0 means no limit
+}
+
+// func creates the trash folder at root if it doesn't exist
+func Open(root string, maxAge time.Duration, maxSize int64) (*Trash, error) {
+
+	root, err := filepath.Abs(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(root, 0700)
+
+	if err != nil {
+		return nil, errors.New("error opening trash " + root + ": " + err.Error())
+	}
+
+	return &Trash{Root: root, MaxAge: maxAge, MaxSize: maxSize}, nil
+}
+
+// renames and hard links of the trash, tests replace them to fail like on another file system
+var (
+	rename = os.Rename
+	link   = os.Link
+)
+
+// func moves the entry at path to the trash folder of the moment at. rel is the path
+// of the entry relative to the synch folder, it is kept inside the trash folder.
+// If the trash is on another file system than path the entry is copied and removed
+func (t *Trash) Move(path, rel string, at time.Time) (string, error) {
+
+	dest, err := t.dest(rel, at)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = rename(path, dest)
+
+	if errors.Is(err, syscall.EXDEV) {
+
+		if err = copyTree(path, dest); err == nil {
+			err = os.RemoveAll(path)
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return dest, nil
+}
+
+// func keeps a hard link to the file at path in the trash folder of the moment at,
+// so the file stays in the trash after it is overwritten. If the trash is on another
+// file system than path the file is copied
+func (t *Trash) Keep(path, rel string, at time.Time) (string, error) {
+
+	dest, err := t.dest(rel, at)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = link(path, dest)
+
+	if errors.Is(err, syscall.EXDEV) {
+		err = copyTree(path, dest)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return dest, nil
+}
+
+// func returns a free path for rel in the trash folder of the moment at and creates its parents
+func (t *Trash) dest(rel string, at time.Time) (string, error) {
+
+	rel = filepath.Clean(rel)
+
+	if rel == "." || filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+		return "", errors.New("wrong path for trash: " + rel)
+	}
+
+	dest := filepath.Join(t.Root, at.UTC().Format(StampLayout), rel)
+
+	err := os.MkdirAll(filepath.Dir(dest), 0700)
+
+	if err != nil {
+		return "", err
+	}
+
+	// the same path may be trashed twice in one check
+	free := dest
+
+	for i := 1; ; i++ {
+
+		_, err = os.Lstat(free)
+
+		if errors.Is(err, os.ErrNotExist) {
+			return free, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		free = dest + "." + strconv.Itoa(i)
+	}
+}
+
+// func returns the moments of the trash folders, the oldest first
+func (t *Trash) Stamps() ([]time.Time, error) {
+
+	folder, err := os.ReadDir(t.Root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stamps := []time.Time{}
+
+	for _, entry := range folder {
+
+		stamp, err := time.ParseInLocation(StampLayout, entry.Name(), time.UTC)
+
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		stamps = append(stamps, stamp)
+	}
+
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i].Before(stamps[j]) })
+
+	return stamps, nil
+}
+
+// func returns the moments of the trash folders that contain rel, the oldest first
+func (t *Trash) Versions(rel string) ([]time.Time, error) {
+
+	stamps, err := t.Stamps()
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []time.Time{}
+
+	for _, stamp := range stamps {
+
+		if _, err = os.Lstat(t.path(rel, stamp)); err == nil {
+			versions = append(versions, stamp)
+		}
+	}
+
+	return versions, nil
+}
+
+// func copies rel from the trash folder of the moment at to dest. If at is zero the latest version is restored.
+// An existing dest is not overwritten
+func (t *Trash) Restore(rel string, at time.Time, dest string) error {
+
+	if at.IsZero() {
+
+		versions, err := t.Versions(rel)
+
+		if err != nil {
+			return err
+		}
+
+		if len(versions) == 0 {
+			return errors.New(rel + " is not found in trash")
+		}
+
+		at = versions[len(versions)-1]
+	}
+
+	if _, err := os.Lstat(dest); err == nil {
+		return errors.New(dest + " already exists")
+	}
+
+	src := t.path(rel, at)
+
+	if _, err := os.Lstat(src); err != nil {
+		return errors.New(rel + " is not found in trash at " + at.UTC().Format(StampLayout))
+	}
+
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	return copyTree(src, dest)
+}
+
+// func copies the file, folder or symlink at src with everything inside to dest.
+// A partial copy is removed if it fails
+func copyTree(src, dest string) error {
+
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dest, strings.TrimPrefix(path, src))
+
+		return copyEntry(path, target, entry)
+	})
+
+	if err != nil {
+		_ = os.RemoveAll(dest)
+	}
+
+	return err
+}
+
+// func returns the path of rel in the trash folder of the moment at
+func (t *Trash) path(rel string, at time.Time) string {
+
+	return filepath.Join(t.Root, at.UTC().Format(StampLayout), filepath.Clean(rel))
+}
+
+// func removes trash folders older than MaxAge and then the oldest folders while the trash is bigger than MaxSize.
+// It returns the moments of the removed folders
+func (t *Trash) Clean(now time.Time) ([]time.Time, error) {
+
+	stamps, err := t.Stamps()
+
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []time.Time{}
+
+	remove := func(stamp time.Time) error {
+
+		err := os.RemoveAll(filepath.Join(t.Root, stamp.Format(StampLayout)))
+
+		if err == nil {
+			removed = append(removed, stamp)
+		}
+
+		return err
+	}
+
+	kept := stamps[:0:0]
+
+	for _, stamp := range stamps {
+
+		if t.MaxAge > 0 && now.Sub(stamp) > t.MaxAge {
+
+			if err = remove(stamp); err != nil {
+				return removed, err
+			}
+
+			continue
+		}
+
+		kept = append(kept, stamp)
+	}
+
+	if t.MaxSize <= 0 {
+		return removed, nil
+	}
+
+	sizes := make([]int64, len(kept))
+	total := int64(0)
+
+	for i, stamp := range kept {
+
+		sizes[i], err = size(filepath.Join(t.Root, stamp.Format(StampLayout)))
+
+		if err != nil {
+			return removed, err
+		}
+
+		total += sizes[i]
+	}
+
+	for i := 0; i < len(kept) && total > t.MaxSize; i++ {
+
+		if err = remove(kept[i]); err != nil {
+			return removed, err
+		}
+
+		total -= sizes[i]
+	}
+
+	return removed, nil
+}
+
+// func returns the total size of files in the trash
+func (t *Trash) Size() (int64, error) {
+
+	return size(t.Root)
+}
+
+// func returns the total size of files in the folder
+func size(path string) (int64, error) {
+
+	total := int64(0)
+
+	err := filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if entry.Type().IsRegular() {
+
+			info, err := entry.Info()
+
+			if err != nil {
+				return err
+			}
+
+			total += info.Size()
+		}
+
+		return nil
+	})
+
+	return total, err
+}
+
+// func copies a single file, folder or symlink with its mode. Files keep their modification time
+func copyEntry(src, dest string, entry fs.DirEntry) error {
+
+	info, err := entry.Info()
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+
+	case info.IsDir():
+
+		return os.Mkdir(dest, info.Mode().Perm())
+
+	case info.Mode()&os.ModeSymlink != 0:
+
+		target, err := os.Readlink(src)
+
+		if err != nil {
+			return err
+		}
+
+		return os.Symlink(target, dest)
+
+	case info.Mode().IsRegular():
+
+		err = copyFile(src, dest, info.Mode().Perm())
+
+		if err != nil {
+			return err
+		}
+
+		return os.Chtimes(dest, info.ModTime(), info.ModTime())
+	}
+
+	// special files are not restored
+	return nil
+}
+
+// func copies the content of a file
+func copyFile(src, dest string, perm os.FileMode) error {
+
+	in, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// func parses a size like 512, 100K, 20M or 1G
+func ParseSize(value string) (int64, error) {
+
+	original := value
+
+	value = strings.ToUpper(strings.TrimSpace(value))
+
+	multiplier := int64(1)
+
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40} {
+
+		if strings.HasSuffix(value, suffix) {
+			multiplier = m
+			value = strings.TrimSuffix(value, suffix)
+			break
+		}
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil || number < 0 {
+		return 0, errors.New("wrong size " + original + ". Size may be a number of bytes with K, M, G or T suffix")
+	}
+
+	return number * multiplier, nil
+}
@@ -0,0 +1,245 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveAndRestore(t *testing.T) {
+
+	req := require.New(t)
+
+	slavePath := t.TempDir()
+	sourcePath := t.TempDir()
+
+	tr, err := Open(t.TempDir()+"/trash", 0, 0)
+	req.NoError(err)
+
+	first := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	req.NoError(os.MkdirAll(slavePath+"/dir/sub", 0755))
+	req.NoError(os.WriteFile(slavePath+"/dir/sub/file1", []byte("old"), 0644))
+	req.NoError(os.Symlink("sub/file1", slavePath+"/dir/link"))
+
+	dest, err := tr.Move(slavePath+"/dir", "dir", first)
+	req.NoError(err)
+	req.Equal(tr.Root+"/2026-01-02T03-04-05.000000000/dir", dest)
+
+	_, err = os.Stat(slavePath + "/dir")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	// an overwritten file stays in the trash
+	req.NoError(os.MkdirAll(slavePath+"/dir/sub", 0755))
+	req.NoError(os.WriteFile(slavePath+"/dir/sub/file1", []byte("new"), 0644))
+
+	_, err = tr.Keep(slavePath+"/dir/sub/file1", "dir/sub/file1", second)
+	req.NoError(err)
+	req.NoError(os.WriteFile(slavePath+"/dir/sub/file1.tmp", []byte("newer"), 0644))
+	req.NoError(os.Rename(slavePath+"/dir/sub/file1.tmp", slavePath+"/dir/sub/file1"))
+
+	// the same path twice in one check
+	dest, err = tr.Keep(slavePath+"/dir/sub/file1", "dir/sub/file1", second)
+	req.NoError(err)
+	req.Equal(tr.Root+"/2026-01-02T04-04-05.000000000/dir/sub/file1.1", dest)
+
+	versions, err := tr.Versions("dir/sub/file1")
+	req.NoError(err)
+	req.Equal([]time.Time{first, second}, versions)
+
+	// the latest version
+	req.NoError(tr.Restore("dir/sub/file1", time.Time{}, sourcePath+"/file1"))
+
+	data, err := os.ReadFile(sourcePath + "/file1")
+	req.NoError(err)
+	req.Equal("new", string(data))
+
+	// a whole folder of the given version
+	req.NoError(tr.Restore("dir", first, sourcePath+"/dir"))
+
+	data, err = os.ReadFile(sourcePath + "/dir/sub/file1")
+	req.NoError(err)
+	req.Equal("old", string(data))
+
+	target, err := os.Readlink(sourcePath + "/dir/link")
+	req.NoError(err)
+	req.Equal("sub/file1", target)
+
+	req.EqualError(tr.Restore("dir", first, sourcePath+"/dir"), sourcePath+"/dir already exists")
+	req.EqualError(tr.Restore("missing", time.Time{}, sourcePath+"/missing"), "missing is not found in trash")
+
+	_, err = tr.Move(slavePath+"/dir", "../dir", first)
+	req.EqualError(err, "wrong path for trash: ../dir")
+
+}
+
+func TestOtherFileSystem(t *testing.T) {
+
+	req := require.New(t)
+
+	// the trash is on another device than the synch folder
+	defer func() { rename, link = os.Rename, os.Link }()
+
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+
+	link = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "link", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+
+	slavePath := t.TempDir()
+
+	tr, err := Open(t.TempDir()+"/trash", 0, 0)
+	req.NoError(err)
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	req.NoError(os.MkdirAll(slavePath+"/dir/sub", 0755))
+	req.NoError(os.WriteFile(slavePath+"/dir/sub/file1", []byte("old"), 0644))
+	req.NoError(os.Symlink("sub/file1", slavePath+"/dir/link"))
+	req.NoError(os.WriteFile(slavePath+"/file2", []byte("kept"), 0644))
+
+	// a folder is copied and removed
+	dest, err := tr.Move(slavePath+"/dir", "dir", at)
+	req.NoError(err)
+
+	_, err = os.Stat(slavePath + "/dir")
+	req.ErrorIs(err, os.ErrNotExist)
+
+	data, err := os.ReadFile(dest + "/sub/file1")
+	req.NoError(err)
+	req.Equal("old", string(data))
+
+	target, err := os.Readlink(dest + "/link")
+	req.NoError(err)
+	req.Equal("sub/file1", target)
+
+	// a file that is overwritten is copied and stays in the synch folder
+	dest, err = tr.Keep(slavePath+"/file2", "file2", at)
+	req.NoError(err)
+
+	data, err = os.ReadFile(dest)
+	req.NoError(err)
+	req.Equal("kept", string(data))
+
+	_, err = os.Stat(slavePath + "/file2")
+	req.NoError(err)
+
+	// other errors are returned
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EINVAL}
+	}
+
+	_, err = tr.Move(slavePath+"/file2", "file2", at)
+	req.ErrorIs(err, syscall.EINVAL)
+
+}
+
+func TestClean(t *testing.T) {
+
+	req := require.New(t)
+
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	stamps := []time.Time{now.Add(-72 * time.Hour), now.Add(-48 * time.Hour), now.Add(-24 * time.Hour), now}
+
+	cases := map[string]struct {
+		maxAge  time.Duration
+		maxSize int64
+		removed []time.Time
+	}{
+		"no limits": {
+			removed: []time.Time{},
+		},
+
+		"by age": {
+			maxAge:  36 * time.Hour,
+			removed: stamps[:2],
+		},
+
+		"by size": {
+			maxSize: 250,
+			removed: stamps[:2],
+		},
+
+		"by age and size": {
+			maxAge:  60 * time.Hour,
+			maxSize: 100,
+			removed: stamps[:3],
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			tr, err := Open(t.TempDir(), cs.maxAge, cs.maxSize)
+			req.NoError(err)
+
+			for _, stamp := range stamps {
+
+				path := filepath.Join(tr.Root, stamp.Format(StampLayout), "dir")
+
+				req.NoError(os.MkdirAll(path, 0755))
+				req.NoError(os.WriteFile(path+"/file1", make([]byte, 100), 0644))
+			}
+
+			// other files are not touched
+			req.NoError(os.WriteFile(tr.Root+"/notes", []byte("test"), 0644))
+
+			removed, err := tr.Clean(now)
+			req.NoError(err)
+			req.Equal(cs.removed, removed)
+
+			left, err := tr.Stamps()
+			req.NoError(err)
+			req.Equal(stamps[len(cs.removed):], left)
+
+			_, err = os.Stat(tr.Root + "/notes")
+			req.NoError(err)
+
+			total, err := tr.Size()
+			req.NoError(err)
+			req.Equal(int64(100*len(left)+4), total)
+		})
+	}
+
+}
+
+func TestParseSize(t *testing.T) {
+
+	req := require.New(t)
+
+	cases := map[string]struct {
+		value   string
+		size    int64
+		isError bool
+	}{
+		"bytes":     {value: "512", size: 512},
+		"kilobytes": {value: "100K", size: 100 << 10},
+		"megabytes": {value: "20m", size: 20 << 20},
+		"gigabytes": {value: "1G", size: 1 << 30},
+		"wrong":     {value: "ten", isError: true},
+		"negative":  {value: "-1", isError: true},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			size, err := ParseSize(cs.value)
+
+			if cs.isError {
+				req.EqualError(err, "wrong size "+cs.value+". Size may be a number of bytes with K, M, G or T suffix")
+			} else {
+				req.NoError(err)
+				req.Equal(cs.size, size)
+			}
+		})
+	}
+
+}
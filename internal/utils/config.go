@@ -0,0 +1,1325 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"synchfolder/internal/logger"
+	"synchfolder/internal/synch"
+	"synchfolder/internal/trash"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// prefix of environment variables that override config values, for example SYNCHFOLDER_LOGLEVEL
+const EnvPrefix = "SYNCHFOLDER_"
+
+// name of the job made of the top level sourcepath and synchpath
+const DefaultJob = "default"
+
+// JobConfig is the configuration of a sync job
+type JobConfig struct {
+	Name         string
+	SourcePath   string
+	SynchPath    string
+	Compare      string
+	Mode         string
+	Interval     time.Duration
+	Reconcile    time.Duration
+	Preserve     []string
+	Symlinks     string
+	HardLinks    bool
+	Specials     string
+	MaxDeletions int
+	Trash        string
+	TrashAge     time.Duration
+	TrashSize    int64
+	AbortCount   int
+	AbortPercent float64
+	Sentinel     string
+
+	Include        []string
+	Exclude        []string
+	IgnoreFile     string
+	MinSize        int64
+	MaxSize        int64
+	MinAge         time.Duration
+	MaxAge         time.Duration
+	DeleteExcluded bool
+}
+
+// Config is the configuration of the app. Job values set at the top level are defaults of every job
+type Config struct {
+	JobConfig
+	LogLevel    string
+	LogFormat   string
+	LogMaxSize  int64     // the log file is rotated when it is bigger, 0 is no limit
+	LogDaily    bool      // the log file is rotated every day
+	LogKeep     int       // rotated log files that are kept
+	LogOverflow string    // what senders do when the logger is behind
+	LogSinks    []LogSink // where the logger writes
+	LogColor    bool      // errors are colored on the console
+	DryRun      bool
+	Report      string
+	Workers     int           // copies at the same time
+	Meta        int           // metadata operations at the same time
+	Shutdown    time.Duration // how long copies in progress may go on after the app is stopped
+	Jobs        []*JobConfig
+}
+
+// LogSink is a sink of the logger with its minimum level, the level is LogLevel if it is empty
+type LogSink struct {
+	Name  string
+	Level string
+}
+
+// ConfigError lists all problems of a config, every problem points at its file and line
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+
+	return strings.Join(e.Problems, "\n")
+}
+
+// setting is a single value read from a config file or the environment
+type setting struct {
+	key   string
+	value string
+	where string // file and line or the name of the environment variable
+}
+
+// options sets the value of every key of the app that can't be set for a job
+var options = map[string]func(c *Config, value string) error{
+
+	"report": func(c *Config, value string) error { c.Report = value; return nil },
+
+	"loglevel": func(c *Config, value string) (err error) {
+		c.LogLevel, err = oneOf(strings.ToUpper(value), logger.LogInfo, logger.LogError, logger.LogCritical)
+		return err
+	},
+
+	"logformat": func(c *Config, value string) (err error) {
+		c.LogFormat, err = oneOf(strings.ToLower(value), logger.FormatText, logger.FormatJSON, logger.FormatLogfmt)
+		return err
+	},
+
+	"logmaxsize": func(c *Config, value string) (err error) {
+		c.LogMaxSize, err = parseSize(value)
+		return err
+	},
+
+	"logdaily": func(c *Config, value string) (err error) {
+		c.LogDaily, err = parseBool(value)
+		return err
+	},
+
+	"logkeep": func(c *Config, value string) (err error) {
+		c.LogKeep, err = parseCount(value)
+		return err
+	},
+
+	"logoverflow": func(c *Config, value string) (err error) {
+		c.LogOverflow, err = oneOf(strings.ToLower(value), logger.OverflowBlock, logger.OverflowDropOldest, logger.OverflowDropNewest)
+		return err
+	},
+
+	"logsinks": func(c *Config, value string) error {
+
+		c.LogSinks = []LogSink{}
+
+		for _, item := range strings.Split(value, ",") {
+
+			name, level, _ := strings.Cut(strings.TrimSpace(item), ":")
+			name = strings.ToLower(strings.TrimSpace(name))
+			level = strings.ToUpper(strings.TrimSpace(level))
+
+			if name == "" {
+				continue
+			}
+
+			if _, err := oneOf(name, logger.SinkFile, logger.SinkConsole, logger.SinkSyslog, logger.SinkJournald); err != nil {
+				return err
+			}
+
+			if level != "" {
+				if _, err := oneOf(level, logger.LogInfo, logger.LogError, logger.LogCritical); err != nil {
+					return err
+				}
+			}
+
+			c.LogSinks = append(c.LogSinks, LogSink{Name: name, Level: level})
+		}
+
+		if len(c.LogSinks) == 0 {
+			return errors.New("must name at least one sink")
+		}
+
+		return nil
+	},
+
+	"logcolor": func(c *Config, value string) (err error) {
+		c.LogColor, err = parseBool(value)
+		return err
+	},
+
+	"dryrun": func(c *Config, value string) (err error) {
+		c.DryRun, err = parseBool(value)
+		return err
+	},
+
+	"workers": func(c *Config, value string) (err error) {
+
+		c.Workers, err = parseCount(value)
+
+		if err == nil && c.Workers == 0 {
+			err = errors.New("must be a number from 1")
+		}
+
+		return err
+	},
+
+	"metaworkers": func(c *Config, value string) (err error) {
+
+		c.Meta, err = parseCount(value)
+
+		if err == nil && c.Meta == 0 {
+			err = errors.New("must be a number from 1")
+		}
+
+		return err
+	},
+
+	"shutdowntimeout": func(c *Config, value string) (err error) {
+		c.Shutdown, err = parseDuration(value)
+		return err
+	},
+}
+
+// jobOptions sets the value of every key of a job
+var jobOptions = map[string]func(c *JobConfig, value string) error{
+
+	"sourcepath": func(c *JobConfig, value string) error { c.SourcePath = value; return nil },
+	"synchpath":  func(c *JobConfig, value string) error { c.SynchPath = value; return nil },
+	"trash":      func(c *JobConfig, value string) error { c.Trash = value; return nil },
+	"sentinel":   func(c *JobConfig, value string) error { c.Sentinel = value; return nil },
+	"ignorefile": func(c *JobConfig, value string) error { c.IgnoreFile = value; return nil },
+	"include":    func(c *JobConfig, value string) error { c.Include = patterns(value); return nil },
+	"exclude":    func(c *JobConfig, value string) error { c.Exclude = patterns(value); return nil },
+
+	"compare": func(c *JobConfig, value string) (err error) {
+		c.Compare, err = oneOf(strings.ToUpper(value), synch.CompareSize, synch.CompareModTime, synch.CompareSHA256, synch.CompareFNV)
+		return err
+	},
+
+	"mode": func(c *JobConfig, value string) (err error) {
+		c.Mode, err = oneOf(strings.ToLower(value), "poll", "watch")
+		return err
+	},
+
+	"symlinks": func(c *JobConfig, value string) (err error) {
+		c.Symlinks, err = oneOf(strings.ToUpper(value), synch.SymlinkCopy, synch.SymlinkFollow, synch.SymlinkSkip)
+		return err
+	},
+
+	"specials": func(c *JobConfig, value string) (err error) {
+		c.Specials, err = oneOf(strings.ToUpper(value), synch.SpecialSkip, synch.SpecialRecreate)
+		return err
+	},
+
+	"preserve": func(c *JobConfig, value string) error {
+
+		c.Preserve = []string{}
+
+		for _, item := range strings.Split(value, ",") {
+
+			item = strings.ToLower(strings.TrimSpace(item))
+
+			if item == "" {
+				continue
+			}
+
+			if _, err := oneOf(item, "all", "mode", "times", "owner", "xattrs"); err != nil {
+				return err
+			}
+
+			c.Preserve = append(c.Preserve, item)
+		}
+
+		return nil
+	},
+
+	"interval": func(c *JobConfig, value string) (err error) {
+
+		c.Interval, err = parseDuration(value)
+
+		if err == nil && c.Interval == 0 {
+			err = errors.New("must be longer than 0")
+		}
+
+		return err
+	},
+
+	"reconcile": func(c *JobConfig, value string) (err error) {
+		c.Reconcile, err = parseDuration(value)
+		return err
+	},
+
+	"trashage": func(c *JobConfig, value string) (err error) {
+		c.TrashAge, err = parseDuration(value)
+		return err
+	},
+
+	"hardlinks": func(c *JobConfig, value string) (err error) {
+		c.HardLinks, err = parseBool(value)
+		return err
+	},
+
+	"maxdeletions": func(c *JobConfig, value string) (err error) {
+		c.MaxDeletions, err = parseCount(value)
+		return err
+	},
+
+	"abortcount": func(c *JobConfig, value string) (err error) {
+		c.AbortCount, err = parseCount(value)
+		return err
+	},
+
+	"abortpercent": func(c *JobConfig, value string) error {
+
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+
+		if err != nil || percent < 0 || percent > 100 {
+			return errors.New("must be a percent from 0 to 100")
+		}
+
+		c.AbortPercent = percent
+
+		return nil
+	},
+
+	"trashsize": func(c *JobConfig, value string) (err error) {
+		c.TrashSize, err = parseSize(value)
+		return err
+	},
+
+	"minsize": func(c *JobConfig, value string) (err error) {
+		c.MinSize, err = parseSize(value)
+		return err
+	},
+
+	"maxsize": func(c *JobConfig, value string) (err error) {
+		c.MaxSize, err = parseSize(value)
+		return err
+	},
+
+	"minage": func(c *JobConfig, value string) (err error) {
+		c.MinAge, err = parseDuration(value)
+		return err
+	},
+
+	"maxage": func(c *JobConfig, value string) (err error) {
+		c.MaxAge, err = parseDuration(value)
+		return err
+	},
+
+	"deleteexcluded": func(c *JobConfig, value string) (err error) {
+		c.DeleteExcluded, err = parseBool(value)
+		return err
+	},
+}
+
+// func returns the config with default values
+func DefaultConfig() *Config {
+
+	return &Config{
+		JobConfig: JobConfig{
+			Compare:   synch.CompareSHA256,
+			Mode:      "poll",
+			Interval:  3 * time.Second,
+			Reconcile: 10 * time.Minute,
+			Preserve:  []string{},
+			Symlinks:  synch.SymlinkCopy,
+			Specials:  synch.SpecialSkip,
+
+			Include:    []string{},
+			Exclude:    []string{},
+			IgnoreFile: synch.IgnoreFile,
+		},
+		LogLevel:    logger.LogInfo,
+		LogFormat:   logger.FormatText,
+		LogKeep:     7,
+		LogOverflow: logger.OverflowBlock,
+		LogSinks:    []LogSink{{Name: logger.SinkFile}},
+		Workers:     8,
+		Meta:        16,
+		Shutdown:    30 * time.Second,
+	}
+}
+
+// func reads the config at path. The format is found by the extension: .yaml or .yml for YAML, .json for JSON,
+// .toml for TOML and key=value lines for anything else. Environment variables override values of the file
+func LoadConfig(path string) (*Config, error) {
+
+	return LoadConfigWith(path, nil)
+}
+
+// func is LoadConfig where flags override values of the file and the environment. Flags are
+// config keys with their values given on the command line. If path is empty only flags are used
+func LoadConfigWith(path string, flags map[string]string) (*Config, error) {
+
+	var logError logger.LogMessage = logger.LogMessage{LogType: logger.LogCritical, Ref: "LoadConfig", Message: ""}
+
+	if path == "" {
+		return buildConfig(append(envSettings(os.Environ()), flagSettings(flags)...))
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+
+		logError.Message = "error reading config: " + err.Error()
+		logger.Send(logError)
+
+		return nil, err
+	}
+
+	name := filepath.Base(path)
+
+	var settings []setting
+
+	switch strings.ToLower(filepath.Ext(path)) {
+
+	case ".yaml", ".yml":
+		settings, err = parseYAML(name, data)
+
+	case ".json":
+		settings, err = parseJSON(name, data)
+
+	case ".toml":
+		settings, err = parseTOML(name, data)
+
+	default:
+		settings, err = parseKeyValue(name, data)
+	}
+
+	if err != nil {
+		return nil, &ConfigError{Problems: []string{err.Error()}}
+	}
+
+	settings = append(settings, envSettings(os.Environ())...)
+
+	return buildConfig(append(settings, flagSettings(flags)...))
+}
+
+// func applies settings to the default config and validates the result. Keys like jobs.<name>.<key>
+// set values of the job name, other values of jobs are taken from the top level
+func buildConfig(settings []setting) (*Config, error) {
+
+	cfg := DefaultConfig()
+
+	problems := []string{}
+	where := map[string]string{}
+
+	names := []string{}
+	jobSettings := map[string][]setting{}
+
+	for _, s := range settings {
+
+		// the environment and flags override the file, the file can't set a key twice
+		if first, ok := where[s.key]; ok && !strings.HasPrefix(s.where, "environment") && !strings.HasPrefix(s.where, "flag") {
+			problems = append(problems, s.where+": key "+s.key+" is already set at "+first)
+			continue
+		}
+
+		if strings.HasPrefix(s.key, "jobs.") {
+
+			name, key, err := jobKey(s.key)
+
+			if err != nil {
+				problems = append(problems, s.where+": "+err.Error())
+				continue
+			}
+
+			if _, ok := jobSettings[name]; !ok {
+				names = append(names, name)
+			}
+
+			where[s.key] = s.where
+			jobSettings[name] = append(jobSettings[name], setting{key: key, value: s.value, where: s.where})
+
+			continue
+		}
+
+		var err error
+
+		if set, ok := options[s.key]; ok {
+			err = set(cfg, s.value)
+
+		} else if set, ok := jobOptions[s.key]; ok {
+			err = set(&cfg.JobConfig, s.value)
+
+		} else {
+			problems = append(problems, s.where+": unknown key "+strconv.Quote(s.key)+suggest(s.key))
+			continue
+		}
+
+		where[s.key] = s.where
+
+		if err != nil {
+			problems = append(problems, s.where+": "+s.key+": "+err.Error())
+		}
+	}
+
+	// the top level paths are a job too, it is the only job if no jobs are set
+	implicit := cfg.SynchPath != "" || len(names) == 0
+
+	if implicit {
+
+		job := cfg.JobConfig
+		job.Name = DefaultJob
+
+		cfg.Jobs = append(cfg.Jobs, &job)
+	}
+
+	for _, name := range names {
+
+		if name == DefaultJob && implicit {
+			problems = append(problems, jobSettings[name][0].where+": job "+DefaultJob+" is already set by the top level synchpath")
+			continue
+		}
+
+		job := cfg.JobConfig
+		job.Name = name
+		job.Preserve = append([]string{}, cfg.Preserve...)
+		job.Trash = ""
+
+		for _, s := range jobSettings[name] {
+
+			if err := jobOptions[s.key](&job, s.value); err != nil {
+				problems = append(problems, s.where+": "+s.key+": "+err.Error())
+			}
+		}
+
+		cfg.Jobs = append(cfg.Jobs, &job)
+	}
+
+	// every job gets its own folder of the top level trash
+	for _, job := range cfg.Jobs {
+
+		if _, ok := where["jobs."+job.Name+".trash"]; ok || job.Name == DefaultJob && len(cfg.Jobs) == 1 {
+			continue
+		}
+
+		if cfg.Trash != "" {
+			job.Trash = filepath.Join(cfg.Trash, job.Name)
+		}
+	}
+
+	problems = append(problems, cfg.validate(where)...)
+
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+
+	return cfg, nil
+}
+
+// func splits a key like jobs.<name>.<key> into the name of the job and the key
+func jobKey(key string) (string, string, error) {
+
+	rest := strings.TrimPrefix(key, "jobs.")
+	dot := strings.LastIndex(rest, ".")
+
+	if dot <= 0 {
+		return "", "", errors.New("expected jobs.<name>.<key>, got " + strconv.Quote(key))
+	}
+
+	name, key := rest[:dot], rest[dot+1:]
+
+	for _, r := range name {
+
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", "", errors.New("wrong job name " + strconv.Quote(name) + ", it may have letters, digits, - and _")
+		}
+	}
+
+	if _, ok := options[key]; ok {
+		return "", "", errors.New("key " + key + " can't be set for a job")
+	}
+
+	if _, ok := jobOptions[key]; !ok {
+		return "", "", errors.New("unknown key " + strconv.Quote(key) + suggest(key))
+	}
+
+	return name, key, nil
+}
+
+// func checks values that depend on each other and returns the problems
+func (c *Config) validate(where map[string]string) []string {
+
+	problems := []string{}
+
+	for _, job := range c.Jobs {
+		problems = append(problems, job.validate(where)...)
+	}
+
+	// jobs must not write into folders of each other
+	for i, a := range c.Jobs {
+
+		for _, b := range c.Jobs[i+1:] {
+
+			if a.SynchPath == "" || b.SynchPath == "" {
+				continue
+			}
+
+			aTarget, _ := filepath.Abs(a.SynchPath)
+			bTarget, _ := filepath.Abs(b.SynchPath)
+
+			if inside(aTarget, bTarget) || inside(bTarget, aTarget) {
+				problems = append(problems, "jobs "+a.Name+" and "+b.Name+": synchpath must not be the same folder or inside each other")
+			}
+
+			if a.Trash != "" && b.Trash != "" {
+
+				aTrash, _ := filepath.Abs(a.Trash)
+				bTrash, _ := filepath.Abs(b.Trash)
+
+				if inside(aTrash, bTrash) || inside(bTrash, aTrash) {
+					problems = append(problems, "jobs "+a.Name+" and "+b.Name+": trash must not be the same folder or inside each other")
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// func checks values of the job that depend on each other and returns the problems
+func (j *JobConfig) validate(where map[string]string) []string {
+
+	problems := []string{}
+
+	prefix := ""
+
+	if j.Name != DefaultJob {
+		prefix = "job " + j.Name + ": "
+	}
+
+	at := func(key string) string {
+
+		if w, ok := where["jobs."+j.Name+"."+key]; ok && j.Name != DefaultJob {
+			return w + ": " + prefix
+		}
+
+		if w, ok := where[key]; ok {
+			return w + ": " + prefix
+		}
+
+		return prefix
+	}
+
+	if j.SourcePath == "" {
+		problems = append(problems, at("sourcepath")+"sourcepath is required")
+	}
+
+	if j.SynchPath == "" {
+		problems = append(problems, at("synchpath")+"synchpath is required")
+	}
+
+	if j.SourcePath != "" && j.SynchPath != "" {
+
+		source, _ := filepath.Abs(j.SourcePath)
+		target, _ := filepath.Abs(j.SynchPath)
+
+		if inside(source, target) || inside(target, source) {
+			problems = append(problems, at("synchpath")+"sourcepath and synchpath must not be the same folder or inside each other")
+		}
+	}
+
+	if j.Trash != "" && j.SourcePath != "" {
+
+		source, _ := filepath.Abs(j.SourcePath)
+		trashPath, _ := filepath.Abs(j.Trash)
+
+		if inside(trashPath, source) {
+			problems = append(problems, at("trash")+"trash must not be inside sourcepath")
+		}
+	}
+
+	if j.TrashAge != 0 && j.Trash == "" {
+		problems = append(problems, at("trashage")+"trashage is set without trash")
+	}
+
+	if j.TrashSize != 0 && j.Trash == "" {
+		problems = append(problems, at("trashsize")+"trashsize is set without trash")
+	}
+
+	if j.MaxSize != 0 && j.MinSize > j.MaxSize {
+		problems = append(problems, at("maxsize")+"maxsize must not be less than minsize")
+	}
+
+	if j.MaxAge != 0 && j.MinAge > j.MaxAge {
+		problems = append(problems, at("maxage")+"maxage must not be less than minage")
+	}
+
+	return problems
+}
+
+// func checks if path is folder or inside it
+func inside(path, folder string) bool {
+
+	return path == folder || strings.HasPrefix(path, folder+string(filepath.Separator))
+}
+
+// func splits a comma separated list of patterns
+func patterns(value string) []string {
+
+	list := []string{}
+
+	for _, item := range strings.Split(value, ",") {
+
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// func returns value if it is one of allowed
+func oneOf(value string, allowed ...string) (string, error) {
+
+	for _, a := range allowed {
+
+		if value == a {
+			return value, nil
+		}
+	}
+
+	return "", errors.New("unknown value " + strconv.Quote(value) + ", may be " + strings.Join(allowed, ", "))
+}
+
+// func parses a duration like 30s, 10m or 1h. 0 or empty value is allowed
+func parseDuration(value string) (time.Duration, error) {
+
+	if value == "0" || value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+
+	if err != nil || d < 0 {
+		return 0, errors.New("must be a duration like 30s, 10m or 1h")
+	}
+
+	return d, nil
+}
+
+// func parses a size like 500M or 10G. Empty value means 0
+func parseSize(value string) (int64, error) {
+
+	if value == "" {
+		return 0, nil
+	}
+
+	return trash.ParseSize(value)
+}
+
+// func parses true or false
+func parseBool(value string) (bool, error) {
+
+	b, err := strconv.ParseBool(value)
+
+	if err != nil {
+		return false, errors.New("must be true or false")
+	}
+
+	return b, nil
+}
+
+// func parses a number that is not negative
+func parseCount(value string) (int, error) {
+
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n < 0 {
+		return 0, errors.New("must be a number from 0")
+	}
+
+	return n, nil
+}
+
+// func returns a hint with a known key that looks like key, for example for a typo
+func suggest(key string) string {
+
+	keys := make([]string, 0, len(options)+len(jobOptions))
+
+	for k := range options {
+		keys = append(keys, k)
+	}
+
+	for k := range jobOptions {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		if distance(key, k) <= 2 {
+			return ", did you mean " + strconv.Quote(k) + "?"
+		}
+	}
+
+	return ""
+}
+
+// func returns the edit distance between two strings
+func distance(a, b string) int {
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+
+			cost := 1
+
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = smallest(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// func returns the smallest of the numbers
+func smallest(n ...int) int {
+
+	m := n[0]
+
+	for _, v := range n[1:] {
+
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
+
+// func returns settings of environment variables with EnvPrefix sorted by key. SYNCHFOLDER_<KEY> sets a top level key,
+// SYNCHFOLDER_JOBS_<NAME>_<KEY> sets a key of the job. Other variables with the prefix are logged and ignored,
+// so the environment of other tools doesn't stop the app
+func envSettings(environ []string) []setting {
+
+	settings := []setting{}
+
+	for _, env := range environ {
+
+		name, value, ok := strings.Cut(env, "=")
+
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+
+		key, ok := envKey(strings.ToLower(strings.TrimPrefix(name, EnvPrefix)))
+
+		if !ok {
+			logger.Send(logger.Info("LoadConfig", "environment variable "+name+" is not a config key, it is ignored"))
+			continue
+		}
+
+		settings = append(settings, setting{key: key, value: strings.TrimSpace(value), where: "environment variable " + name})
+	}
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].key < settings[j].key })
+
+	return settings
+}
+
+// func returns the config key of the lower case name of an environment variable without the prefix:
+// the key itself or jobs.<name>.<key> for jobs_<name>_<key>
+func envKey(name string) (string, bool) {
+
+	known := func(key string) bool {
+
+		_, option := options[key]
+		_, jobOption := jobOptions[key]
+
+		return option || jobOption
+	}
+
+	if known(name) {
+		return name, true
+	}
+
+	rest := strings.TrimPrefix(name, "jobs_")
+
+	// keys have no underscores, job names may have them
+	if under := strings.LastIndex(rest, "_"); rest != name && under > 0 && known(rest[under+1:]) {
+		return "jobs." + rest[:under] + "." + rest[under+1:], true
+	}
+
+	return "", false
+}
+
+// func returns settings of flags sorted by key
+func flagSettings(flags map[string]string) []setting {
+
+	settings := []setting{}
+
+	for key, value := range flags {
+		settings = append(settings, setting{key: strings.ToLower(key), value: value, where: "flag for " + key})
+	}
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].key < settings[j].key })
+
+	return settings
+}
+
+// func reads lines like key=value. Empty lines and lines starting with # are skipped
+func parseKeyValue(name string, data []byte) ([]setting, error) {
+
+	settings := []setting{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for line := 1; scanner.Scan(); line++ {
+
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key=value, got %q", name, line, text)
+		}
+
+		settings = append(settings, setting{
+			key:   strings.ToLower(strings.TrimSpace(key)),
+			value: strings.TrimSpace(value),
+			where: fmt.Sprintf("%s:%d", name, line),
+		})
+	}
+
+	return settings, scanner.Err()
+}
+
+// func reads a YAML mapping of keys to scalars or lists of scalars. Jobs are a mapping of names to such mappings
+func parseYAML(name string, data []byte) ([]setting, error) {
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+
+		// errors look like "yaml: line 3: mapping values are not allowed in this context"
+		message := strings.TrimPrefix(err.Error(), "yaml: ")
+
+		if strings.HasPrefix(message, "line ") {
+			return nil, errors.New(name + ":" + strings.TrimPrefix(message, "line "))
+		}
+
+		return nil, errors.New(name + ": " + message)
+	}
+
+	settings := []setting{}
+
+	// an empty file
+	if len(doc.Content) == 0 {
+		return settings, nil
+	}
+
+	return yamlMapping(name, "", doc.Content[0], settings)
+}
+
+// func appends settings of a YAML mapping, their keys start with prefix
+func yamlMapping(name, prefix string, node *yaml.Node, settings []setting) ([]setting, error) {
+
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: expected a mapping of keys to values", name, node.Line)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+
+		key, value := node.Content[i], node.Content[i+1]
+
+		where := fmt.Sprintf("%s:%d", name, key.Line)
+
+		// every job is a mapping of its keys
+		if prefix == "" && strings.ToLower(key.Value) == "jobs" {
+
+			if value.Kind != yaml.MappingNode {
+				return nil, errors.New(where + ": jobs: expected a mapping of job names to their keys")
+			}
+
+			for j := 0; j+1 < len(value.Content); j += 2 {
+
+				var err error
+
+				settings, err = yamlMapping(name, "jobs."+strings.ToLower(value.Content[j].Value)+".", value.Content[j+1], settings)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			continue
+		}
+
+		text, err := yamlValue(value)
+
+		if err != nil {
+			return nil, errors.New(where + ": " + key.Value + ": " + err.Error())
+		}
+
+		settings = append(settings, setting{key: prefix + strings.ToLower(key.Value), value: text, where: where})
+	}
+
+	return settings, nil
+}
+
+// func returns a scalar as it is and a list of scalars separated by commas
+func yamlValue(node *yaml.Node) (string, error) {
+
+	switch node.Kind {
+
+	case yaml.ScalarNode:
+
+		if node.Tag == "!!null" {
+			return "", nil
+		}
+
+		return strings.TrimSpace(node.Value), nil
+
+	case yaml.SequenceNode:
+
+		items := []string{}
+
+		for _, item := range node.Content {
+
+			if item.Kind != yaml.ScalarNode {
+				return "", errors.New("expected a list of values")
+			}
+
+			items = append(items, item.Value)
+		}
+
+		return strings.Join(items, ","), nil
+	}
+
+	return "", errors.New("expected a value or a list of values")
+}
+
+// func reads a JSON object of keys to strings, numbers, booleans or arrays of them.
+// Jobs are an object of names to such objects
+func parseJSON(name string, data []byte) ([]setting, error) {
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	fail := func(offset int64, err error) error {
+
+		var syntaxErr *json.SyntaxError
+
+		if errors.As(err, &syntaxErr) {
+			offset = syntaxErr.Offset
+		}
+
+		return fmt.Errorf("%s:%d: %s", name, lineAt(data, offset), err.Error())
+	}
+
+	// func reads the next token that must open an object
+	open := func(problem string) error {
+
+		token, err := dec.Token()
+
+		if err != nil {
+			return fail(dec.InputOffset(), err)
+		}
+
+		if delim, ok := token.(json.Delim); !ok || delim != '{' {
+			return fail(dec.InputOffset(), errors.New(problem))
+		}
+
+		return nil
+	}
+
+	var object func(prefix string, settings []setting) ([]setting, error)
+
+	object = func(prefix string, settings []setting) ([]setting, error) {
+
+		if err := open("expected an object of keys to values"); err != nil {
+			return nil, err
+		}
+
+		for dec.More() {
+
+			token, err := dec.Token()
+
+			if err != nil {
+				return nil, fail(dec.InputOffset(), err)
+			}
+
+			key := token.(string)
+			where := fmt.Sprintf("%s:%d", name, lineAt(data, dec.InputOffset()))
+
+			// every job is an object of its keys
+			if prefix == "" && strings.ToLower(key) == "jobs" {
+
+				if err = open("jobs: expected an object of job names to their keys"); err != nil {
+					return nil, err
+				}
+
+				for dec.More() {
+
+					token, err = dec.Token()
+
+					if err != nil {
+						return nil, fail(dec.InputOffset(), err)
+					}
+
+					settings, err = object("jobs."+strings.ToLower(token.(string))+".", settings)
+
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				if _, err = dec.Token(); err != nil {
+					return nil, fail(dec.InputOffset(), err)
+				}
+
+				continue
+			}
+
+			var value interface{}
+
+			if err = dec.Decode(&value); err != nil {
+				return nil, fail(dec.InputOffset(), err)
+			}
+
+			text, err := jsonValue(value)
+
+			if err != nil {
+				return nil, errors.New(where + ": " + key + ": " + err.Error())
+			}
+
+			settings = append(settings, setting{key: prefix + strings.ToLower(key), value: text, where: where})
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return nil, fail(dec.InputOffset(), err)
+		}
+
+		return settings, nil
+	}
+
+	return object("", []setting{})
+}
+
+// func returns a JSON value as text, arrays are separated by commas
+func jsonValue(value interface{}) (string, error) {
+
+	switch v := value.(type) {
+
+	case nil:
+		return "", nil
+
+	case string:
+		return strings.TrimSpace(v), nil
+
+	case json.Number:
+		return v.String(), nil
+
+	case bool:
+		return strconv.FormatBool(v), nil
+
+	case []interface{}:
+
+		items := []string{}
+
+		for _, item := range v {
+
+			text, err := jsonValue(item)
+
+			if _, isList := item.([]interface{}); err != nil || isList {
+				return "", errors.New("expected an array of values")
+			}
+
+			items = append(items, text)
+		}
+
+		return strings.Join(items, ","), nil
+	}
+
+	return "", errors.New("expected a value or an array of values")
+}
+
+// func returns the number of the line at offset
+func lineAt(data []byte, offset int64) int {
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// func reads TOML keys with strings, numbers, booleans and arrays of them. The only tables are [jobs.<name>]
+func parseTOML(name string, data []byte) ([]setting, error) {
+
+	settings := []setting{}
+
+	prefix := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for line := 1; scanner.Scan(); line++ {
+
+		where := fmt.Sprintf("%s:%d", name, line)
+
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+
+			table := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "["), "]"))
+
+			if !strings.HasSuffix(text, "]") || !strings.HasPrefix(table, "jobs.") || len(table) == len("jobs.") {
+				return nil, errors.New(where + ": only [jobs.<name>] tables are supported")
+			}
+
+			prefix = strings.ToLower(table) + "."
+
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+
+		if !ok {
+			return nil, errors.New(where + ": expected key = value")
+		}
+
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+
+		text, err := tomlValue(strings.TrimSpace(value))
+
+		if err != nil {
+			return nil, errors.New(where + ": " + key + ": " + err.Error())
+		}
+
+		settings = append(settings, setting{key: prefix + strings.ToLower(key), value: text, where: where})
+	}
+
+	return settings, scanner.Err()
+}
+
+// func removes a comment that is not inside a string
+func stripComment(line string) string {
+
+	var quote rune
+
+	for i, r := range line {
+
+		switch {
+
+		case quote != 0 && r == quote:
+			quote = 0
+
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// func returns a TOML value as text, arrays are separated by commas
+func tomlValue(value string) (string, error) {
+
+	switch {
+
+	case strings.HasPrefix(value, "["):
+
+		if !strings.HasSuffix(value, "]") {
+			return "", errors.New("arrays must be on one line")
+		}
+
+		items := []string{}
+
+		for _, item := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"), ",") {
+
+			item = strings.TrimSpace(item)
+
+			if item == "" {
+				continue
+			}
+
+			text, err := tomlValue(item)
+
+			if err != nil {
+				return "", err
+			}
+
+			items = append(items, text)
+		}
+
+		return strings.Join(items, ","), nil
+
+	case strings.HasPrefix(value, `"`):
+
+		text, err := strconv.Unquote(value)
+
+		if err != nil {
+			return "", errors.New("wrong string " + value)
+		}
+
+		return strings.TrimSpace(text), nil
+
+	case strings.HasPrefix(value, "'"):
+
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", errors.New("wrong string " + value)
+		}
+
+		return strings.TrimSpace(value[1 : len(value)-1]), nil
+
+	case value == "":
+		return "", errors.New("value is missing")
+	}
+
+	// numbers and booleans
+	return value, nil
+}
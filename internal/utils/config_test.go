@@ -0,0 +1,439 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+
+	root, _ := filepath.Abs("../../")
+
+	req := require.New(t)
+
+	full := DefaultConfig()
+	full.SourcePath = "c:/temp/master"
+	full.SynchPath = "c:/temp/slave"
+	full.LogLevel = "ERROR"
+	full.LogFormat = "json"
+	full.LogMaxSize = 10 << 20
+	full.LogDaily = true
+	full.LogKeep = 3
+	full.LogOverflow = "drop-oldest"
+	full.LogSinks = []LogSink{{Name: "file"}, {Name: "console", Level: "ERROR"}}
+	full.LogColor = true
+	full.Preserve = []string{"mode", "times"}
+	full.Reconcile = 30 * time.Second
+	full.HardLinks = true
+	full.AbortPercent = 50
+	full.Trash = "c:/temp/trash"
+	full.TrashSize = 1 << 30
+
+	simple := DefaultConfig()
+	simple.SourcePath = "c:/temp/master"
+	simple.SynchPath = "c:/temp/slave"
+
+	// the top level paths are the default job
+	for _, cfg := range []*Config{full, simple} {
+
+		job := cfg.JobConfig
+		job.Name = DefaultJob
+
+		cfg.Jobs = []*JobConfig{&job}
+	}
+
+	cases := map[string]struct {
+		configPath string
+		res        *Config
+	}{
+		"key=value": {
+			configPath: root + "/test/config/test1.txt",
+			res:        simple,
+		},
+
+		"values with spaces": {
+			configPath: root + "/test/config/test2.txt",
+			res:        simple,
+		},
+
+		"yaml": {
+			configPath: root + "/test/config/config.yaml",
+			res:        full,
+		},
+
+		"json": {
+			configPath: root + "/test/config/config.json",
+			res:        full,
+		},
+
+		"toml": {
+			configPath: root + "/test/config/config.toml",
+			res:        full,
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			res, err := LoadConfig(cs.configPath)
+
+			req.NoError(err)
+			req.Equal(cs.res, res)
+		})
+	}
+
+	_, err := LoadConfig(root + "/test/config/missing.txt")
+	req.ErrorIs(err, os.ErrNotExist)
+
+}
+
+func TestConfigErrors(t *testing.T) {
+
+	req := require.New(t)
+
+	cases := map[string]struct {
+		name     string
+		data     string
+		problems []string
+	}{
+		"unknown key": {
+			name: "config.txt",
+			data: "sourcepath=/master\nsynchpath=/slave\nsoucepath=/master\nwhatever=1",
+			problems: []string{
+				`config.txt:3: unknown key "soucepath", did you mean "sourcepath"?`,
+				`config.txt:4: unknown key "whatever"`,
+			},
+		},
+
+		"value with =": {
+			name: "config.txt",
+			data: "sourcepath=/master=1\nsynchpath=/slave\ndryrun=yes",
+			problems: []string{
+				"config.txt:3: dryrun: must be true or false",
+			},
+		},
+
+		"line without =": {
+			name: "config.txt",
+			data: "sourcepath=/master\n\n# comment\nsynchpath",
+			problems: []string{
+				`config.txt:4: expected key=value, got "synchpath"`,
+			},
+		},
+
+		"wrong values": {
+			name: "config.yaml",
+			data: "sourcepath: /master\nsynchpath: /slave\nloglevel: DEBUG\nreconcile: often\npreserve: [mode, size]\nmaxdeletions: -1",
+			problems: []string{
+				`config.yaml:3: loglevel: unknown value "DEBUG", may be INFO, ERROR, CRITICAL`,
+				"config.yaml:4: reconcile: must be a duration like 30s, 10m or 1h",
+				`config.yaml:5: preserve: unknown value "size", may be all, mode, times, owner, xattrs`,
+				"config.yaml:6: maxdeletions: must be a number from 0",
+			},
+		},
+
+		"wrong sinks": {
+			name: "config.txt",
+			data: "sourcepath=/master\nsynchpath=/slave\nlogsinks=file,eventlog\njobs.a.logsinks=file\n",
+			problems: []string{
+				`config.txt:3: logsinks: unknown value "eventlog", may be file, console, syslog, journald`,
+				"config.txt:4: key logsinks can't be set for a job",
+			},
+		},
+
+		"wrong sink level": {
+			name: "config.txt",
+			data: "sourcepath=/master\nsynchpath=/slave\nlogsinks=console:debug\n",
+			problems: []string{
+				`config.txt:3: logsinks: unknown value "DEBUG", may be INFO, ERROR, CRITICAL`,
+			},
+		},
+
+		"no sinks": {
+			name: "config.txt",
+			data: "sourcepath=/master\nsynchpath=/slave\nlogsinks= , \n",
+			problems: []string{
+				"config.txt:3: logsinks: must name at least one sink",
+			},
+		},
+
+		"yaml syntax": {
+			name: "config.yaml",
+			data: "sourcepath: /master\nsynchpath: /slave\nloglevel: INFO: ERROR\n",
+			problems: []string{
+				"config.yaml:3: mapping values are not allowed in this context",
+			},
+		},
+
+		"json value": {
+			name: "config.json",
+			data: "{\n\"sourcepath\": \"/master\",\n\"synchpath\": {\"path\": \"/slave\"}\n}",
+			problems: []string{
+				"config.json:3: synchpath: expected a value or an array of values",
+			},
+		},
+
+		"json syntax": {
+			name: "config.json",
+			data: "{\n\"sourcepath\": \"/master\",\n\"synchpath\" \"/slave\"\n}",
+			problems: []string{
+				"config.json:3: invalid character '\"' after object key",
+			},
+		},
+
+		"toml table": {
+			name: "config.toml",
+			data: "sourcepath = \"/master\"\n[jobs]\n",
+			problems: []string{
+				"config.toml:2: only [jobs.<name>] tables are supported",
+			},
+		},
+
+		"duplicate key": {
+			name: "config.toml",
+			data: "sourcepath = \"/master\"\nsynchpath = \"/slave\"\nsourcepath = \"/other\"",
+			problems: []string{
+				"config.toml:3: key sourcepath is already set at config.toml:1",
+			},
+		},
+
+		"required keys": {
+			name: "config.txt",
+			data: "loglevel=INFO",
+			problems: []string{
+				"sourcepath is required",
+				"synchpath is required",
+			},
+		},
+
+		"nested folders": {
+			name: "config.txt",
+			data: "sourcepath=/master\nsynchpath=/master/slave\ntrash=/master/trash",
+			problems: []string{
+				"config.txt:2: sourcepath and synchpath must not be the same folder or inside each other",
+				"config.txt:3: trash must not be inside sourcepath",
+			},
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			path := t.TempDir() + "/" + cs.name
+			req.NoError(os.WriteFile(path, []byte(cs.data), 0644))
+
+			_, err := LoadConfig(path)
+
+			var cfgErr *ConfigError
+
+			req.ErrorAs(err, &cfgErr)
+			req.Equal(cs.problems, cfgErr.Problems)
+		})
+	}
+
+}
+
+func TestConfigEnv(t *testing.T) {
+
+	req := require.New(t)
+
+	path := t.TempDir() + "/config.txt"
+	req.NoError(os.WriteFile(path, []byte("sourcepath=/master\nsynchpath=/slave\nmode=watch"), 0644))
+
+	t.Setenv(EnvPrefix+"MODE", "poll")
+	t.Setenv(EnvPrefix+"MAXDELETIONS", "10")
+
+	cfg, err := LoadConfig(path)
+	req.NoError(err)
+	req.Equal("poll", cfg.Mode)
+	req.Equal(10, cfg.MaxDeletions)
+
+	// flags override the environment and the file
+	cfg, err = LoadConfigWith(path, map[string]string{"mode": "watch", "synchpath": "/other"})
+	req.NoError(err)
+	req.Equal("watch", cfg.Mode)
+	req.Equal("/other", cfg.Jobs[0].SynchPath)
+
+	// without a file only flags and the environment are used
+	cfg, err = LoadConfigWith("", map[string]string{"sourcepath": "/master", "synchpath": "/slave"})
+	req.NoError(err)
+	req.Equal("poll", cfg.Mode)
+	req.Equal("/master", cfg.Jobs[0].SourcePath)
+
+	// variables of other tools are ignored
+	t.Setenv(EnvPrefix+"HOME", "/home/alex")
+	t.Setenv(EnvPrefix+"JOBS_DOCS", "1")
+
+	cfg, err = LoadConfig(path)
+	req.NoError(err)
+	req.Equal(10, cfg.MaxDeletions)
+
+	// keys of a job are set by SYNCHFOLDER_JOBS_<NAME>_<KEY>
+	root, _ := filepath.Abs("../../")
+
+	t.Setenv(EnvPrefix+"JOBS_DOCS_COMPARE", "size")
+
+	cfg, err = LoadConfig(root + "/test/config/jobs.txt")
+	req.NoError(err)
+	req.Equal("photos", cfg.Jobs[0].Name)
+	req.Equal("MTIME", cfg.Jobs[0].Compare)
+	req.Equal("docs", cfg.Jobs[1].Name)
+	req.Equal("SIZE", cfg.Jobs[1].Compare)
+
+	// job names may have underscores
+	settings := envSettings([]string{EnvPrefix + "JOBS_MY_PHOTOS_MODE=watch", EnvPrefix + "JOBS_A_LOGLEVEL=INFO", "OTHER=1"})
+	req.Len(settings, 2)
+	req.Equal("jobs.a.loglevel", settings[0].key)
+	req.Equal("jobs.my_photos.mode", settings[1].key)
+
+	req.NoError(os.Unsetenv(EnvPrefix + "JOBS_DOCS_COMPARE"))
+
+	t.Setenv(EnvPrefix+"COMPARE", "md5")
+
+	_, err = LoadConfig(path)
+	req.EqualError(err, `environment variable SYNCHFOLDER_COMPARE: compare: unknown value "MD5", may be SIZE, MTIME, SHA256, FNV`)
+
+}
+
+func TestConfigJobs(t *testing.T) {
+
+	root, _ := filepath.Abs("../../")
+
+	req := require.New(t)
+
+	defaults := DefaultConfig().JobConfig
+	defaults.Compare = "MTIME"
+	defaults.Preserve = []string{"mode"}
+
+	photos := defaults
+	photos.Name = "photos"
+	photos.SourcePath = "c:/photos"
+	photos.SynchPath = "d:/photos"
+	photos.Interval = time.Minute
+	photos.Trash = filepath.Join("d:/trash", "photos") // jobs get their own folder of the top level trash
+
+	docs := defaults
+	docs.Name = "docs"
+	docs.SourcePath = "c:/docs"
+	docs.SynchPath = "d:/docs"
+	docs.Compare = "SHA256"
+	docs.Preserve = []string{"mode", "times"}
+	docs.Trash = "d:/docs-trash"
+
+	for _, name := range []string{"jobs.txt", "jobs.yaml", "jobs.json", "jobs.toml"} {
+		t.Run(name, func(t *testing.T) {
+
+			cfg, err := LoadConfig(root + "/test/config/" + name)
+			req.NoError(err)
+
+			req.Equal(4, cfg.Workers)
+			req.Equal(6, cfg.Meta)
+			req.Equal(10*time.Second, cfg.Shutdown)
+			req.Len(cfg.Jobs, 2)
+
+			req.Equal(&photos, cfg.Jobs[0])
+			req.Equal(&docs, cfg.Jobs[1])
+		})
+	}
+
+	cases := map[string]struct {
+		name     string
+		data     string
+		problems []string
+	}{
+		"job keys": {
+			name: "config.txt",
+			data: "jobs.a.sourcepath=/a\njobs.a.synchpath=/b\njobs.a.loglevel=INFO\njobs.a.soucepath=/a\njobs.A B.mode=poll\njobs.mode=poll\njobs.a.metaworkers=2",
+			problems: []string{
+				"config.txt:3: key loglevel can't be set for a job",
+				`config.txt:4: unknown key "soucepath", did you mean "sourcepath"?`,
+				`config.txt:5: wrong job name "a b", it may have letters, digits, - and _`,
+				`config.txt:6: expected jobs.<name>.<key>, got "jobs.mode"`,
+				"config.txt:7: key metaworkers can't be set for a job",
+			},
+		},
+
+		"job values": {
+			name: "config.yaml",
+			data: "jobs:\n  a:\n    sourcepath: /a\n  b:\n    sourcepath: /b\n    synchpath: /b/copy\n    interval: 0",
+			problems: []string{
+				"config.yaml:7: interval: must be longer than 0",
+				"job a: synchpath is required",
+				"config.yaml:6: job b: sourcepath and synchpath must not be the same folder or inside each other",
+			},
+		},
+
+		"shared folders": {
+			name: "config.toml",
+			data: "synchpath = \"/copy\"\nsourcepath = \"/master\"\ntrash = \"/trash\"\n[jobs.a]\nsourcepath = \"/a\"\nsynchpath = \"/copy/a\"\ntrash = \"/trash\"",
+			problems: []string{
+				"jobs default and a: synchpath must not be the same folder or inside each other",
+				"jobs default and a: trash must not be the same folder or inside each other",
+			},
+		},
+
+		"default job": {
+			name: "config.json",
+			data: "{\n\"sourcepath\": \"/master\",\n\"synchpath\": \"/slave\",\n\"jobs\": {\"default\": {\n\"synchpath\": \"/other\"}}\n}",
+			problems: []string{
+				"config.json:5: job default is already set by the top level synchpath",
+			},
+		},
+
+		"json jobs": {
+			name: "config.json",
+			data: "{\n\"jobs\": [\"a\"]\n}",
+			problems: []string{
+				"config.json:2: jobs: expected an object of job names to their keys",
+			},
+		},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			path := t.TempDir() + "/" + cs.name
+			req.NoError(os.WriteFile(path, []byte(cs.data), 0644))
+
+			_, err := LoadConfig(path)
+
+			var cfgErr *ConfigError
+
+			req.ErrorAs(err, &cfgErr)
+			req.Equal(cs.problems, cfgErr.Problems)
+		})
+	}
+
+}
+
+func TestConfigFilter(t *testing.T) {
+
+	req := require.New(t)
+
+	path := t.TempDir() + "/config.yaml"
+	data := "sourcepath: /master\nsynchpath: /slave\nexclude: [.git/, '*.swp']\ninclude: '*.jpg, *.png'\nignorefile: .ignore\nminsize: 1K\nmaxsize: 1G\nmaxage: 720h\ndeleteexcluded: true"
+	req.NoError(os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := LoadConfig(path)
+	req.NoError(err)
+
+	job := cfg.Jobs[0]
+
+	req.Equal([]string{".git/", "*.swp"}, job.Exclude)
+	req.Equal([]string{"*.jpg", "*.png"}, job.Include)
+	req.Equal(".ignore", job.IgnoreFile)
+	req.Equal(int64(1<<10), job.MinSize)
+	req.Equal(int64(1<<30), job.MaxSize)
+	req.Equal(720*time.Hour, job.MaxAge)
+	req.True(job.DeleteExcluded)
+
+	req.NoError(os.WriteFile(path, []byte("sourcepath: /master\nsynchpath: /slave\nminsize: 1G\nmaxsize: 1K\nminage: 1h\nmaxage: 1m"), 0644))
+
+	_, err = LoadConfig(path)
+	req.EqualError(err, "config.yaml:4: maxsize must not be less than minsize\nconfig.yaml:6: maxage must not be less than minage")
+
+}
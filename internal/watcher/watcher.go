@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Batch is a set of changes collected while the source tree was not quiet
+type Batch struct {
+	Folders []string // folders with changed entries relative to the root, parents go first
+	Rescan  bool     // some events were lost, the whole tree has to be checked
+}
+
+// change is a single event reported by the system. The root folder is ""
+type change struct {
+	folder string
+	rescan bool
+}
+
+// func collects changes until there are no new ones for the quiet period or maxDelay is passed
+// since the first of them, then sends them to events as one batch. Changes that come while
+// the batch is waiting to be received go to the next batch. It returns when changes is closed
+func debounce(changes <-chan change, events chan<- Batch, quiet, maxDelay time.Duration) {
+
+	defer close(events)
+
+	pending := map[string]struct{}{}
+	rescan := false
+	first := time.Time{}
+
+	var out chan<- Batch
+	var batch Batch
+
+	timer := time.NewTimer(quiet)
+	timer.Stop()
+
+	for {
+
+		select {
+
+		case ch, ok := <-changes:
+
+			if !ok {
+				return
+			}
+
+			if len(pending) == 0 && !rescan {
+				first = time.Now()
+			}
+
+			pending[ch.folder] = struct{}{}
+			rescan = rescan || ch.rescan
+
+			if out == nil {
+				resetTimer(timer, quiet, maxDelay-time.Since(first))
+			}
+
+		case <-timer.C:
+
+			batch = newBatch(pending, rescan)
+			out = events
+
+			pending = map[string]struct{}{}
+			rescan = false
+
+		case out <- batch:
+
+			out = nil
+
+			if len(pending) > 0 || rescan {
+				resetTimer(timer, quiet, maxDelay-time.Since(first))
+			}
+		}
+	}
+}
+
+// func restarts the timer with the shortest of two durations
+func resetTimer(timer *time.Timer, quiet, left time.Duration) {
+
+	if left < quiet {
+		quiet = left
+	}
+
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+
+	timer.Reset(quiet)
+}
+
+// func returns pending folders as a batch sorted so that parents go before subfolders
+func newBatch(pending map[string]struct{}, rescan bool) Batch {
+
+	batch := Batch{Rescan: rescan, Folders: make([]string, 0, len(pending))}
+
+	for folder := range pending {
+		batch.Folders = append(batch.Folders, folder)
+	}
+
+	sort.Slice(batch.Folders, func(i, j int) bool {
+
+		di := strings.Count(batch.Folders[i], "/")
+		dj := strings.Count(batch.Folders[j], "/")
+
+		if batch.Folders[i] == "" || batch.Folders[j] == "" || di == dj {
+			return batch.Folders[i] < batch.Folders[j]
+		}
+
+		return di < dj
+	})
+
+	return batch
+}
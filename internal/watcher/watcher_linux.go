@@ -0,0 +1,249 @@
+//go:build linux
+
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_ATTRIB | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF |
+	syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW | syscall.IN_EXCL_UNLINK
+
+// Watcher reports changes in a folder tree using inotify
+type Watcher struct {
+	Events chan Batch
+	Errors chan error
+
+	root     string
+	fd       int
+	file     *os.File       // wraps fd so that reading can be interrupted by closing it
+	watches  map[int]string // watch descriptor -> folder relative to the root
+	quiet    time.Duration
+	maxDelay time.Duration
+}
+
+// func starts watching every folder of the tree under root. Changes are reported
+// to Events after there were no new ones for the quiet period
+func New(root string, quiet time.Duration) (*Watcher, error) {
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &Watcher{
+		Events:   make(chan Batch),
+		Errors:   make(chan error, 10),
+		root:     root,
+		fd:       fd,
+		file:     os.NewFile(uintptr(fd), "inotify"),
+		watches:  map[int]string{},
+		quiet:    quiet,
+		maxDelay: 10 * quiet,
+	}
+
+	_, err = w.addTree("")
+
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// func reads events until ctx is done. Events is closed when it returns
+func (w *Watcher) Run(ctx context.Context) {
+
+	changes := make(chan change, 100)
+
+	go func() {
+		<-ctx.Done()
+		w.file.Close()
+	}()
+
+	go w.read(changes)
+
+	debounce(changes, w.Events, w.quiet, w.maxDelay)
+}
+
+// func reads raw inotify events and turns them into changed folders
+func (w *Watcher) read(changes chan<- change) {
+
+	defer close(changes)
+
+	buf := make([]byte, 64*1024)
+
+	for {
+
+		n, err := w.file.Read(buf)
+
+		if err != nil {
+
+			if !errors.Is(err, os.ErrClosed) {
+				w.error(err)
+			}
+
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+
+			start := offset + syscall.SizeofInotifyEvent
+			offset = start + int(event.Len)
+
+			name := strings.TrimRight(string(buf[start:offset]), "\x00")
+
+			w.handle(int(event.Wd), event.Mask, name, changes)
+		}
+	}
+}
+
+// func handles a single event
+func (w *Watcher) handle(wd int, mask uint32, name string, changes chan<- change) {
+
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		changes <- change{rescan: true}
+		return
+	}
+
+	folder, ok := w.watches[wd]
+
+	if !ok {
+		return
+	}
+
+	switch {
+
+	case mask&syscall.IN_IGNORED != 0:
+
+		delete(w.watches, wd)
+
+	case mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+
+		// the parent folder reports the change, only the root has no parent
+		if folder == "" {
+			changes <- change{rescan: true}
+		}
+
+	case mask&syscall.IN_ISDIR != 0 && mask&syscall.IN_MOVED_FROM != 0:
+
+		w.removeTree(join(folder, name))
+		changes <- change{folder: folder}
+
+	case mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+
+		changes <- change{folder: folder}
+
+		added, err := w.addTree(join(folder, name))
+
+		if err != nil {
+			w.error(err)
+			changes <- change{rescan: true}
+		}
+
+		for _, sub := range added {
+			changes <- change{folder: sub}
+		}
+
+	default:
+
+		changes <- change{folder: folder}
+	}
+}
+
+// func adds watches for the folder and all its subfolders and returns the folders that are watched
+func (w *Watcher) addTree(folder string) ([]string, error) {
+
+	var added []string
+
+	err := filepath.WalkDir(filepath.Join(w.root, folder), func(path string, entry fs.DirEntry, err error) error {
+
+		if err != nil {
+
+			// the folder may be removed while it is walked
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(w.root, path)
+
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			rel = ""
+		}
+
+		wd, err := syscall.InotifyAddWatch(w.fd, path, watchMask)
+
+		if err != nil {
+
+			if errors.Is(err, syscall.ENOENT) {
+				return filepath.SkipDir
+			}
+
+			return os.NewSyscallError("inotify_add_watch "+path, err)
+		}
+
+		w.watches[wd] = rel
+		added = append(added, rel)
+
+		return nil
+	})
+
+	return added, err
+}
+
+// func removes watches for the folder and all its subfolders
+func (w *Watcher) removeTree(folder string) {
+
+	prefix := folder + "/"
+
+	for wd, path := range w.watches {
+
+		if path == folder || strings.HasPrefix(path, prefix) {
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watches, wd)
+		}
+	}
+}
+
+// func reports an error without blocking the watcher
+func (w *Watcher) error(err error) {
+
+	select {
+	case w.Errors <- err:
+	default:
+	}
+}
+
+// func joins a folder relative to the root with an entry name
+func join(folder, name string) string {
+
+	if folder == "" {
+		return name
+	}
+
+	return folder + "/" + name
+}
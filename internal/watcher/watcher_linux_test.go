@@ -0,0 +1,63 @@
+//go:build linux
+
+package watcher
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+
+	req := require.New(t)
+
+	root := t.TempDir()
+
+	req.NoError(os.Mkdir(root+"/dir", 0755))
+
+	w, err := New(root, 50*time.Millisecond)
+	req.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go w.Run(ctx)
+
+	next := func() Batch {
+		select {
+		case batch := <-w.Events:
+			return batch
+		case <-time.After(2 * time.Second):
+			req.Fail("no batch")
+		}
+		return Batch{}
+	}
+
+	req.NoError(os.WriteFile(root+"/dir/file1", []byte("test"), 0644))
+	req.Equal([]string{"dir"}, next().Folders)
+
+	req.NoError(os.MkdirAll(root+"/new/sub", 0755))
+	req.NoError(os.WriteFile(root+"/new/sub/file2", []byte("test"), 0644))
+	req.Subset(next().Folders, []string{"", "new"})
+
+	// the new subfolder is watched too
+	time.Sleep(100 * time.Millisecond)
+	req.NoError(os.WriteFile(root+"/new/sub/file3", []byte("test"), 0644))
+	req.Equal([]string{"new/sub"}, next().Folders)
+
+	req.NoError(os.Rename(root+"/new", root+"/dir/moved"))
+	req.Equal([]string{"", "dir"}, next().Folders[:2])
+
+	time.Sleep(100 * time.Millisecond)
+	req.NoError(os.Remove(root + "/dir/moved/sub/file3"))
+	req.Equal([]string{"dir/moved/sub"}, next().Folders)
+
+	cancel()
+
+	_, ok := <-w.Events
+	req.False(ok)
+
+}
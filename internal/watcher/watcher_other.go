@@ -0,0 +1,25 @@
+//go:build !linux
+
+package watcher
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Watcher reports changes in a folder tree. It is supported only on linux
+type Watcher struct {
+	Events chan Batch
+	Errors chan error
+}
+
+// func always fails, polling has to be used instead
+func New(root string, quiet time.Duration) (*Watcher, error) {
+
+	return nil, errors.New("watch mode is supported only on linux")
+}
+
+// func does nothing
+func (w *Watcher) Run(ctx context.Context) {
+}
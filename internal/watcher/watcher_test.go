@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebounce(t *testing.T) {
+
+	req := require.New(t)
+
+	changes := make(chan change)
+	events := make(chan Batch)
+
+	go debounce(changes, events, 50*time.Millisecond, time.Second)
+
+	changes <- change{folder: "a/b"}
+	changes <- change{folder: ""}
+	changes <- change{folder: "a"}
+	changes <- change{folder: "a"}
+
+	select {
+	case batch := <-events:
+		req.Equal([]string{"", "a", "a/b"}, batch.Folders)
+		req.False(batch.Rescan)
+	case <-time.After(time.Second):
+		req.Fail("no batch")
+	}
+
+	changes <- change{rescan: true}
+
+	batch := <-events
+	req.True(batch.Rescan)
+
+	close(changes)
+
+	_, ok := <-events
+	req.False(ok)
+
+}
+
+func TestNewBatch(t *testing.T) {
+
+	req := require.New(t)
+
+	batch := newBatch(map[string]struct{}{
+		"b/c/d": {},
+		"!x":    {},
+		"a":     {},
+		"":      {},
+		"b/c":   {},
+	}, false)
+
+	req.Equal([]string{"", "!x", "a", "b/c", "b/c/d"}, batch.Folders)
+
+}
@@ -0,0 +1,76 @@
+// Package synch lets other programs keep a folder the same as another one without
+// the settings and the logger of the app. It is the public part of internal/synch
+package synch
+
+import (
+	"synchfolder/internal/logger"
+	"synchfolder/internal/synch"
+)
+
+type (
+	Syncer     = synch.Syncer
+	SyncResult = synch.SyncResult
+	Options    = synch.Options
+	FS         = synch.FS
+	File       = synch.File
+	Logger     = synch.Logger
+	LoggerFunc = synch.LoggerFunc
+	LogMessage = logger.LogMessage
+	Comparator = synch.Comparator
+	Filter     = synch.Filter
+	Preserve   = synch.Preserve
+	Breaker    = synch.Breaker
+	Pool       = synch.Pool
+	Plan       = synch.Plan
+	Operation  = synch.Operation
+	Result     = synch.Result
+	Summary    = synch.Summary
+)
+
+const (
+	CompareSize    = synch.CompareSize
+	CompareModTime = synch.CompareModTime
+	CompareSHA256  = synch.CompareSHA256
+	CompareFNV     = synch.CompareFNV
+
+	SymlinkCopy   = synch.SymlinkCopy
+	SymlinkFollow = synch.SymlinkFollow
+	SymlinkSkip   = synch.SymlinkSkip
+
+	SpecialSkip     = synch.SpecialSkip
+	SpecialRecreate = synch.SpecialRecreate
+
+	LogInfo     = logger.LogInfo
+	LogError    = logger.LogError
+	LogCritical = logger.LogCritical
+)
+
+// file system of the operating system, it is used when the options have no FS
+var OS = synch.OS
+
+// logger that drops all messages, it is used when the options have no logger
+var Discard = synch.Discard
+
+// func returns a syncer of source and dest folders with the options
+func NewSyncer(source, dest string, opts Options) *Syncer {
+
+	return synch.NewSyncer(source, dest, opts)
+}
+
+// func returns a pool of size slots shared by syncers
+func NewPool(size int) *Pool {
+
+	return synch.NewPool(size)
+}
+
+// func returns a pool shared by syncers with data slots for copies and meta slots for other operations
+func NewPoolLimits(data, meta int) *Pool {
+
+	return synch.NewPoolLimits(data, meta)
+}
+
+// func returns the attributes of a comma separated list of mode, times, owner, xattrs or all
+func ParsePreserve(list string) (Preserve, error) {
+
+	return synch.ParsePreserve(list)
+}